@@ -1,20 +1,52 @@
 package combiner
 
 import (
+	"flag"
 	"testing"
 
 	"loov.dev/combiner/internal/testsuite"
 )
 
+var compare = flag.Bool("compare", false, "compare Hierarchical with the flat queue")
+
 // All contains all combiner queue descriptions
 var All = testsuite.Descs{
 	{
 		Name:    "Parking",
 		Bounded: true,
+		Create: func(bat testsuite.Batcher, bound int) testsuite.Combiner {
+			// hide Run and Close, so that callers do the combining
+			return struct{ testsuite.Combiner }{New[interface{}](bat, bound)}
+		},
+	},
+	{
+		Name:    "Offload",
+		Bounded: true,
 		Create: func(bat testsuite.Batcher, bound int) testsuite.Combiner {
 			return New[interface{}](bat, bound)
 		},
 	},
+	{
+		Name:    "Chan",
+		Bounded: true,
+		Create: func(bat testsuite.Batcher, bound int) testsuite.Combiner {
+			return NewChan[interface{}](bat, bound)
+		},
+	},
+	{
+		Name:    "Hierarchical",
+		Bounded: true,
+		Create: func(bat testsuite.Batcher, bound int) testsuite.Combiner {
+			return NewHierarchical[interface{}](bat, bound)
+		},
+	},
+	{
+		Name:    "Hybrid",
+		Bounded: true,
+		Create: func(bat testsuite.Batcher, bound int) testsuite.Combiner {
+			return NewHybrid[interface{}](bat, bound)
+		},
+	},
 }
 
 func Test(t *testing.T) {
@@ -28,3 +60,14 @@ func Benchmark(b *testing.B) {
 		testsuite.RunBenchmarks(b, setup)
 	})
 }
+
+// TestCompareHierarchical reports whether Hierarchical beats
+// the flat queue with many goroutines, run it with -compare.
+func TestCompareHierarchical(t *testing.T) {
+	if !*compare {
+		t.Skip("run with -compare")
+	}
+	params := testsuite.Bench
+	params.Procs = []int{32, 256}
+	params.Compare(All.Find("Parking"), All.Find("Hierarchical"), t.Logf)
+}
@@ -0,0 +1,166 @@
+package combiner
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AutoTune configures automatic adjustment of the queue limit.
+//
+// The tuner measures how long Do takes and how long the batches take.
+// When the 99th percentile of Do latency exceeds Target, the limit is
+// decreased. When the latency is comfortably below Target, the limit is
+// increased, as long as a batch of that size is expected to fit in Target.
+type AutoTune struct {
+	// Target is the desired 99th percentile latency of Do.
+	Target time.Duration
+	// Min is the smallest limit, 1 when zero.
+	Min int
+	// Max is the largest limit, 1024 when zero.
+	Max int
+	// Window is the number of Do calls between adjustments, 256 when zero.
+	Window int
+}
+
+// StartAutoTune starts adjusting the limit of the queue.
+//
+// When the queue has no limit, tuning starts from Max.
+// Only a single tuner can be running for a queue.
+// The returned func stops the tuning and leaves the limit as is.
+func (q *Queue[T]) StartAutoTune(config AutoTune) (stop func()) {
+	t := newTuner(q, config)
+	if !q.tuner.CompareAndSwap(nil, t) {
+		panic("combiner auto-tune already running")
+	}
+	t.clampLimit()
+	return func() { q.tuner.CompareAndSwap(t, nil) }
+}
+
+// limiter is the part of Queue adjusted by tuner.
+type limiter interface {
+	Limit() int
+	SetLimit(limit int)
+}
+
+// tuner adjusts the limit based on observed latencies.
+type tuner struct {
+	config AutoTune
+	queue  limiter
+
+	// cost is the average duration of a single element in a batch.
+	cost atomic.Int64
+
+	next    atomic.Uint64
+	samples []atomic.Int64
+
+	adjusting sync.Mutex
+	sorted    []int64
+}
+
+// newTuner creates a tuner for the queue.
+func newTuner(queue limiter, config AutoTune) *tuner {
+	if config.Target <= 0 {
+		panic("combiner auto-tune target must be positive")
+	}
+	if config.Min <= 0 {
+		config.Min = 1
+	}
+	if config.Max <= 0 {
+		config.Max = 1024
+	}
+	if config.Max < config.Min {
+		config.Max = config.Min
+	}
+	if config.Window <= 0 {
+		config.Window = 256
+	}
+
+	return &tuner{
+		config:  config,
+		queue:   queue,
+		samples: make([]atomic.Int64, config.Window),
+		sorted:  make([]int64, config.Window),
+	}
+}
+
+// clampLimit moves the limit of the queue into the tuned range.
+//
+// It must only be called after the tuner has been installed,
+// so that a rejected tuner does not change the limit.
+func (t *tuner) clampLimit() {
+	limit := t.queue.Limit()
+	if limit == 0 || limit > t.config.Max {
+		limit = t.config.Max
+	}
+	if limit < t.config.Min {
+		limit = t.config.Min
+	}
+	t.queue.SetLimit(limit)
+}
+
+// observeLatency records the latency of a single Do.
+func (t *tuner) observeLatency(start time.Time) {
+	t.observe(time.Since(start))
+}
+
+// observe records a latency sample and adjusts the limit
+// after every window of samples.
+func (t *tuner) observe(latency time.Duration) {
+	n := t.next.Add(1)
+	window := uint64(len(t.samples))
+	t.samples[(n-1)%window].Store(int64(latency))
+	if n%window == 0 && t.adjusting.TryLock() {
+		t.adjust()
+		t.adjusting.Unlock()
+	}
+}
+
+// observeBatch records the duration of a batch of count elements.
+func (t *tuner) observeBatch(start time.Time, count int64) {
+	cost := int64(time.Since(start)) / count
+	// exponentially weighted moving average with alpha = 1/8
+	if prev := t.cost.Load(); prev != 0 {
+		cost = prev + (cost-prev)/8
+	}
+	t.cost.Store(cost)
+}
+
+// adjust updates the limit based on the current samples.
+func (t *tuner) adjust() {
+	for i := range t.samples {
+		t.sorted[i] = t.samples[i].Load()
+	}
+	sort.Slice(t.sorted, func(i, k int) bool { return t.sorted[i] < t.sorted[k] })
+	p99 := time.Duration(t.sorted[len(t.sorted)*99/100])
+
+	limit := t.queue.Limit()
+	target := t.config.Target
+	switch {
+	case p99 > target:
+		next := limit * 3 / 4
+		if next == limit {
+			next--
+		}
+		limit = next
+	case p99 < target*3/4:
+		step := limit / 8
+		if step < 1 {
+			step = 1
+		}
+		next := limit + step
+		if cost := time.Duration(t.cost.Load()); cost > 0 && cost*time.Duration(next) > target {
+			return
+		}
+		limit = next
+	}
+
+	if limit < t.config.Min {
+		limit = t.config.Min
+	}
+	if limit > t.config.Max {
+		limit = t.config.Max
+	}
+	t.queue.SetLimit(limit)
+}
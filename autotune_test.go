@@ -0,0 +1,97 @@
+package combiner
+
+import (
+	"testing"
+	"time"
+)
+
+type nopBatcher struct{}
+
+func (nopBatcher) Start()  {}
+func (nopBatcher) Do(int)  {}
+func (nopBatcher) Finish() {}
+
+func TestAutoTune(t *testing.T) {
+	q := New[int](nopBatcher{}, 0)
+	stop := q.StartAutoTune(AutoTune{
+		Target: time.Millisecond,
+		Min:    2,
+		Max:    64,
+		Window: 100,
+	})
+	defer stop()
+
+	if q.Limit() != 64 {
+		t.Fatalf("expected to start from max, got %v", q.Limit())
+	}
+
+	tuner := q.tuner.Load()
+	window := func(latency time.Duration) {
+		for i := 0; i < 100; i++ {
+			tuner.observe(latency)
+		}
+	}
+
+	window(2 * time.Millisecond)
+	if q.Limit() != 48 {
+		t.Fatalf("expected decrease to 48, got %v", q.Limit())
+	}
+	for i := 0; i < 20; i++ {
+		window(2 * time.Millisecond)
+	}
+	if q.Limit() != 2 {
+		t.Fatalf("expected decrease to min, got %v", q.Limit())
+	}
+
+	window(800 * time.Microsecond)
+	if q.Limit() != 2 {
+		t.Fatalf("expected no change near target, got %v", q.Limit())
+	}
+
+	window(100 * time.Microsecond)
+	if q.Limit() != 3 {
+		t.Fatalf("expected increase to 3, got %v", q.Limit())
+	}
+
+	// batches of 4 elements are expected to take 1.2ms
+	tuner.cost.Store(int64(300 * time.Microsecond))
+	window(100 * time.Microsecond)
+	if q.Limit() != 3 {
+		t.Fatalf("expected no increase beyond estimated cost, got %v", q.Limit())
+	}
+}
+
+func TestAutoTuneAlreadyRunning(t *testing.T) {
+	q := New[int](nopBatcher{}, 10)
+	stop := q.StartAutoTune(AutoTune{Target: time.Millisecond, Max: 64})
+	defer stop()
+	q.SetLimit(10)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		q.StartAutoTune(AutoTune{Target: time.Millisecond, Max: 4})
+	}()
+
+	if q.Limit() != 10 {
+		t.Fatalf("rejected tuner changed the limit to %v", q.Limit())
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	q := New[int](nopBatcher{}, 0)
+	q.SetLimit(5)
+	if q.Limit() != 5 {
+		t.Fatalf("got %v", q.Limit())
+	}
+	q.Do(1)
+
+	stop := q.StartAutoTune(AutoTune{Target: time.Second})
+	stop()
+	if q.tuner.Load() != nil {
+		t.Fatal("tuner not stopped")
+	}
+}
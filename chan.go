@@ -0,0 +1,215 @@
+package combiner
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chan is a channel based combiner.
+//
+// Callers send their values through a buffered channel to a goroutine
+// running Run, which processes them in batches. It is the classic
+// alternative to a combining queue and is useful for comparing the two.
+//
+// After Close, Do processes the value on the calling goroutine,
+// the same way as Queue does when it is idle.
+type Chan[T any] struct {
+	limit    int64
+	batcher  Batcher[T]
+	requests chan chanRequest[T]
+	stats    queueStats
+
+	// mu orders sending requests with Close.
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	// closeOnce closes closing, before Close waits for senders.
+	closeOnce sync.Once
+	// running is held while processing batches, either by Run
+	// or by Do after Close.
+	running sync.Mutex
+
+	done  sync.Pool
+	batch []chanRequest[T]
+
+	// Linger decides how long Run waits for more elements
+	// before finishing a batch. Nil means no waiting.
+	Linger Linger
+}
+
+// chanRequest is a value waiting to be processed.
+type chanRequest[T any] struct {
+	arg  T
+	done chan struct{}
+}
+
+// chanBuffer is the channel capacity, when there is no limit.
+const chanBuffer = 64
+
+// NewChan creates a new channel based combiner.
+func NewChan[T any](batcher Batcher[T], limit int) *Chan[T] {
+	c := &Chan[T]{}
+	c.Init(batcher, limit)
+	return c
+}
+
+// Init initializes a Chan combiner.
+// Note: NewChan does this automatically.
+func (c *Chan[T]) Init(batcher Batcher[T], limit int) {
+	if limit < 0 {
+		panic("combiner limit must be positive")
+	}
+
+	buffer := limit
+	if buffer == 0 {
+		buffer = chanBuffer
+	}
+
+	c.batcher = batcher
+	c.limit = int64(limit)
+	c.requests = make(chan chanRequest[T], buffer)
+	c.closing = make(chan struct{})
+}
+
+// Limit returns the maximum number of elements in a single batch.
+// Zero means there is no limit.
+func (c *Chan[T]) Limit() int { return int(atomic.LoadInt64(&c.limit)) }
+
+// SetLimit changes the maximum number of elements in a single batch.
+// Zero means there is no limit.
+//
+// The capacity of the channel is not changed.
+func (c *Chan[T]) SetLimit(limit int) {
+	if limit < 0 {
+		panic("combiner limit must be positive")
+	}
+	atomic.StoreInt64(&c.limit, int64(limit))
+}
+
+// Do passes value to Batcher and waits for completion.
+func (c *Chan[T]) Do(arg T) {
+	done, _ := c.done.Get().(chan struct{})
+	if done == nil {
+		done = make(chan struct{}, 1)
+	}
+
+	r := chanRequest[T]{arg: arg, done: done}
+
+	sent := false
+	c.mu.RLock()
+	if !c.closed {
+		// The channel may be full without Run, so give up
+		// sending once Close has been called.
+		select {
+		case c.requests <- r:
+			sent = true
+		case <-c.closing:
+		}
+	}
+	c.mu.RUnlock()
+
+	if !sent {
+		c.running.Lock()
+		c.combine(r)
+		c.running.Unlock()
+	}
+
+	<-done
+	c.done.Put(done)
+}
+
+// Run processes batches until Close is called.
+func (c *Chan[T]) Run() {
+	c.running.Lock()
+	defer c.running.Unlock()
+
+	for {
+		select {
+		case r := <-c.requests:
+			c.combine(r)
+		case <-c.closing:
+			c.drain()
+			return
+		}
+	}
+}
+
+// drain processes the requests sent before Close.
+func (c *Chan[T]) drain() {
+	for {
+		select {
+		case r := <-c.requests:
+			c.combine(r)
+		default:
+			return
+		}
+	}
+}
+
+// Close stops Run and waits until the values sent before Close
+// have been processed, also when Run was never started.
+//
+// Do calls that are blocked on a full channel when Close is called
+// process their value on the calling goroutine.
+func (c *Chan[T]) Close() {
+	// Wake up Do calls blocked on a full channel,
+	// before waiting for them to release mu.
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	// Wait for Run to return, no more requests can be sent.
+	c.running.Lock()
+	c.drain()
+	c.running.Unlock()
+}
+
+// combine processes a batch starting with r.
+func (c *Chan[T]) combine(r chanRequest[T]) {
+	limit := atomic.LoadInt64(&c.limit)
+
+	c.batcher.Start()
+	c.batcher.Do(r.arg)
+	batch := append(c.batch[:0], r)
+
+	lingered := false
+combining:
+	for int64(len(batch)) != limit {
+		select {
+		case r := <-c.requests:
+			c.batcher.Do(r.arg)
+			batch = append(batch, r)
+		default:
+			if lingered || c.Linger == nil {
+				break combining
+			}
+			// Wait once per batch for more values to arrive.
+			lingered = true
+			delay := c.Linger.Linger(c.Stats(), len(batch))
+			if delay <= 0 {
+				break combining
+			}
+			time.Sleep(delay)
+		}
+	}
+
+	c.stats.record(int64(len(batch)), false)
+	c.batcher.Finish()
+
+	for i, r := range batch {
+		r.done <- struct{}{}
+		batch[i] = chanRequest[T]{}
+	}
+	c.batch = batch[:0]
+}
+
+// Stats returns a snapshot of the combiner statistics.
+func (c *Chan[T]) Stats() Stats {
+	return Stats{
+		Batches:  atomic.LoadUint64(&c.stats.batches),
+		Elements: atomic.LoadUint64(&c.stats.elements),
+	}
+}
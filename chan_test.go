@@ -0,0 +1,140 @@
+package combiner_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+type batchSizes struct {
+	size  int
+	sizes []int
+}
+
+func (b *batchSizes) Start()  { b.size = 0 }
+func (b *batchSizes) Do(int)  { b.size++ }
+func (b *batchSizes) Finish() { b.sizes = append(b.sizes, b.size) }
+
+func TestChan(t *testing.T) {
+	batcher := &batchSizes{}
+	c := combiner.NewChan[int](batcher, 4)
+	c.Linger = combiner.FixedLinger(time.Millisecond)
+
+	ran := make(chan struct{})
+	go func() { c.Run(); close(ran) }()
+
+	const procs, count = 8, 50
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				c.Do(i)
+			}
+		}()
+	}
+	wg.Wait()
+	c.Close()
+	<-ran
+
+	total, combined := 0, 0
+	for _, size := range batcher.sizes {
+		if size > 4 {
+			t.Fatalf("batch size %v exceeds limit", size)
+		}
+		if size > 1 {
+			combined++
+		}
+		total += size
+	}
+	if total != procs*count {
+		t.Fatalf("expected %v elements, got %v", procs*count, total)
+	}
+	if combined == 0 {
+		t.Fatal("expected linger to combine elements")
+	}
+	if stats := c.Stats(); stats.Batches != uint64(len(batcher.sizes)) || stats.Elements != procs*count {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestChanClose(t *testing.T) {
+	batcher := &batchSizes{}
+	c := combiner.NewChan[int](batcher, 4)
+
+	ran := make(chan struct{})
+	go func() { c.Run(); close(ran) }()
+
+	// Do racing with Close is either processed by Run or by the caller
+	const procs, count = 8, 50
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				c.Do(i)
+			}
+		}()
+	}
+	c.Close()
+	<-ran
+	wg.Wait()
+
+	total := 0
+	for _, size := range batcher.sizes {
+		total += size
+	}
+	if total != procs*count {
+		t.Fatalf("expected %v elements, got %v", procs*count, total)
+	}
+}
+
+func TestChanCloseWithoutRun(t *testing.T) {
+	batcher := &batchSizes{}
+	c := combiner.NewChan[int](batcher, 4)
+	c.Close()
+	c.Do(1)
+	if len(batcher.sizes) != 1 {
+		t.Fatalf("expected Do to be processed after Close, got %v", batcher.sizes)
+	}
+}
+
+func TestChanCloseWithoutRunFull(t *testing.T) {
+	batcher := &batchSizes{}
+	c := combiner.NewChan[int](batcher, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Do(i)
+		}(i)
+	}
+	// Give the second Do time to block on the full channel.
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		wg.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by Do waiting on a full channel")
+	}
+
+	total := 0
+	for _, size := range batcher.sizes {
+		total += size
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 elements, got %v", batcher.sizes)
+	}
+}
@@ -0,0 +1,35 @@
+package combiner
+
+// NewCoalescing creates a new combiner queue that coalesces
+// identical elements within a batch.
+//
+// ResultBatcher.Do is called once for each distinct key in a batch,
+// and every element with the same key receives the same result and error.
+func NewCoalescing[K comparable, T, R any](batcher ResultBatcher[T, R], limit int, key func(T) K) *ResultQueue[T, R] {
+	q := &ResultQueue[T, R]{}
+	q.Init(batcher, limit)
+	q.batcher.coalesce = &keyCoalescer[K, T, R]{
+		key:     key,
+		leaders: map[K]*call[T, R]{},
+	}
+	return q
+}
+
+// keyCoalescer finds duplicate calls by key.
+//
+// It is only used by the combiner, so it does not need locking.
+type keyCoalescer[K comparable, T, R any] struct {
+	key     func(T) K
+	leaders map[K]*call[T, R]
+}
+
+func (k *keyCoalescer[K, T, R]) reset() { clear(k.leaders) }
+
+func (k *keyCoalescer[K, T, R]) duplicate(c *call[T, R]) *call[T, R] {
+	key := k.key(c.arg)
+	if leader, ok := k.leaders[key]; ok {
+		return leader
+	}
+	k.leaders[key] = c
+	return nil
+}
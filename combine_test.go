@@ -54,3 +54,19 @@ func BenchmarkNopContended(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkHybridNopUncontended(b *testing.B) {
+	q := combiner.NewHybrid[int](&Nop{}, 256)
+	for i := 0; i < b.N; i++ {
+		q.Do(123)
+	}
+}
+
+func BenchmarkHybridNopContended(b *testing.B) {
+	q := combiner.NewHybrid[int](&Nop{}, 256)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.Do(122)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package combiner
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ContextBatcher is the operation combining implementation that
+// receives the contexts of the callers.
+//
+// ContextBatcher must not panic.
+type ContextBatcher[T any] interface {
+	// Start is called on a start of a new batch.
+	//
+	// The deadline of ctx is the earliest deadline of the batch elements
+	// and ctx is cancelled when all of the element contexts are cancelled.
+	// BatchLen(ctx) returns the number of elements in the batch.
+	Start(ctx context.Context)
+	// Do is called for each batch element with the context of its caller.
+	Do(ctx context.Context, arg T)
+	// Finish is called after completing a batch.
+	Finish()
+}
+
+// ContextQueue is a combiner queue that passes caller contexts
+// to the ContextBatcher.
+//
+// The elements of a batch are collected before calling Start,
+// so that the batch context can be derived from all of them.
+type ContextQueue[T any] struct {
+	queue   Queue[contextElement[T]]
+	batcher contextBatcher[T]
+}
+
+// contextElement is an element with the context of its caller.
+type contextElement[T any] struct {
+	ctx   context.Context
+	value T
+}
+
+// contextBatcher collects the batch and passes it to ContextBatcher.
+type contextBatcher[T any] struct {
+	batcher  ContextBatcher[T]
+	elements []contextElement[T]
+}
+
+func (b *contextBatcher[T]) Start() { b.elements = b.elements[:0] }
+
+func (b *contextBatcher[T]) Do(elem contextElement[T]) {
+	b.elements = append(b.elements, elem)
+}
+
+func (b *contextBatcher[T]) Finish() {
+	ctx, cancel := batchContext(b.elements)
+	b.batcher.Start(ctx)
+	for _, elem := range b.elements {
+		b.batcher.Do(elem.ctx, elem.value)
+	}
+	b.batcher.Finish()
+	cancel()
+	clear(b.elements)
+}
+
+// NewContextQueue creates a new combiner queue for a ContextBatcher.
+func NewContextQueue[T any](batcher ContextBatcher[T], limit int) *ContextQueue[T] {
+	q := &ContextQueue[T]{}
+	q.Init(batcher, limit)
+	return q
+}
+
+// Init initializes a ContextQueue combiner.
+// Note: NewContextQueue does this automatically.
+func (q *ContextQueue[T]) Init(batcher ContextBatcher[T], limit int) {
+	q.batcher.batcher = batcher
+	q.queue.Init(&q.batcher, limit)
+}
+
+// DoContext passes value to ContextBatcher and waits for completion.
+//
+// DoContext returns ctx.Err() without adding the value to the queue,
+// when ctx is already done. Once the value has been added, DoContext
+// waits for its completion even when ctx is cancelled.
+func (q *ContextQueue[T]) DoContext(ctx context.Context, arg T) error {
+	return q.queue.DoContext(ctx, contextElement[T]{ctx: ctx, value: arg})
+}
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *ContextQueue[T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *ContextQueue[T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *ContextQueue[T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *ContextQueue[T]) Control() Control { return &q.queue }
+
+// batchLenKey is the context key for the number of elements in a batch.
+type batchLenKey struct{}
+
+// BatchLen returns the number of elements in the batch of ctx
+// passed to ContextBatcher.Start.
+func BatchLen(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(batchLenKey{}).(int)
+	return n, ok
+}
+
+// batchContext creates a context with the earliest deadline of elements,
+// which is cancelled when all of the element contexts are cancelled.
+func batchContext[T any](elements []contextElement[T]) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(context.Background(), batchLenKey{}, len(elements))
+
+	var deadline time.Time
+	cancellable := true
+	for _, elem := range elements {
+		if d, ok := elem.ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+		if elem.ctx.Done() == nil {
+			cancellable = false
+		}
+	}
+
+	var cancel context.CancelFunc
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	if !cancellable || len(elements) == 0 {
+		return ctx, cancel
+	}
+
+	remaining := int64(len(elements))
+	stops := make([]func() bool, 0, len(elements))
+	for _, elem := range elements {
+		stops = append(stops, context.AfterFunc(elem.ctx, func() {
+			if atomic.AddInt64(&remaining, -1) == 0 {
+				cancel()
+			}
+		}))
+	}
+
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
+}
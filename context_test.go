@@ -0,0 +1,111 @@
+package combiner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+type contextBatch struct {
+	ctx      context.Context
+	count    int
+	contexts []context.Context
+}
+
+type contextRecorder struct {
+	batch   contextBatch
+	batches chan contextBatch
+	release chan struct{}
+}
+
+func (b *contextRecorder) Start(ctx context.Context) {
+	count, _ := BatchLen(ctx)
+	b.batch = contextBatch{ctx: ctx, count: count}
+}
+
+func (b *contextRecorder) Do(ctx context.Context, arg int) {
+	b.batch.contexts = append(b.batch.contexts, ctx)
+}
+
+func (b *contextRecorder) Finish() {
+	b.batches <- b.batch
+	<-b.release
+}
+
+func TestContextQueue(t *testing.T) {
+	batcher := &contextRecorder{batches: make(chan contextBatch, 1), release: make(chan struct{})}
+	close(batcher.release)
+	q := NewContextQueue[int](batcher, 0)
+
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if err := q.DoContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	batch := <-batcher.batches
+	if d, _ := batch.ctx.Deadline(); batch.count != 1 || !d.Equal(deadline) || batch.contexts[0] != ctx {
+		t.Fatalf("unexpected batch count %v, deadline %v", batch.count, d)
+	}
+	if batch.ctx.Err() == nil {
+		t.Fatal("batch context should be cancelled after the batch")
+	}
+
+	cancel()
+	if err := q.DoContext(ctx, 1); err != context.Canceled {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestContextQueueMerged(t *testing.T) {
+	batcher := &contextRecorder{batches: make(chan contextBatch), release: make(chan struct{})}
+	q := NewContextQueue[int](batcher, 0)
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	do := func(ctx context.Context) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.DoContext(ctx, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// block the combiner in Finish, while others are linked
+	do(context.Background())
+	<-batcher.batches
+
+	var cancels []context.CancelFunc
+	for _, d := range []time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour} {
+		ctx, cancel := context.WithDeadline(context.Background(), now.Add(d))
+		cancels = append(cancels, cancel)
+		do(ctx)
+	}
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == 3 })
+	batcher.release <- struct{}{}
+
+	batch := <-batcher.batches
+	if d, _ := batch.ctx.Deadline(); batch.count != 3 || !d.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected batch count %v, deadline %v", batch.count, d.Sub(now))
+	}
+	for _, cancel := range cancels {
+		if batch.ctx.Err() != nil {
+			t.Fatal("batch cancelled before all elements were cancelled")
+		}
+		cancel()
+	}
+	select {
+	case <-batch.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("batch was not cancelled")
+	}
+
+	close(batcher.release)
+	wg.Wait()
+}
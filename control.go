@@ -0,0 +1,25 @@
+package combiner
+
+// Control is the part of Queue that does not depend on the element type.
+//
+// Queues built on top of Queue, such as PriorityQueue or ResultQueue,
+// return their underlying Queue from their Control method. This gives
+// access to the options, offloading and monitoring of the queue.
+type Control interface {
+	// Options returns the options of the queue,
+	// they must be set before the queue is used.
+	Options() *QueueOptions
+
+	Limit() int
+	SetLimit(limit int)
+	Stats() Stats
+
+	Run()
+	Close()
+
+	StartWatchdog(w Watchdog) (stop func())
+	StartAutoTune(config AutoTune) (stop func())
+}
+
+// Options returns the options of the queue.
+func (q *Queue[T]) Options() *QueueOptions { return &q.QueueOptions }
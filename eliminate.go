@@ -0,0 +1,75 @@
+package combiner
+
+// Eliminator pairs up elements of a batch that cancel each other out,
+// such as a push and a pop, and completes them without calling
+// ResultBatcher.Do.
+//
+// A ResultBatcher that implements Eliminator is used by ResultQueue
+// to eliminate elements before applying the rest of the batch.
+type Eliminator[T, R any] interface {
+	// Eliminate is called with each batch before any of its elements
+	// are passed to ResultBatcher. The elements completed by Eliminate
+	// are not passed to ResultBatcher. When all of them are completed,
+	// ResultBatcher is not called at all.
+	Eliminate(batch *Elimination[T, R])
+}
+
+// Elimination is a batch seen by Eliminator.
+//
+// It is only valid during the Eliminate call.
+type Elimination[T, R any] struct {
+	calls []*call[T, R]
+	done  []bool
+}
+
+// reset prepares for a new batch.
+func (e *Elimination[T, R]) reset() {
+	clear(e.calls)
+	e.calls = e.calls[:0]
+	e.done = e.done[:0]
+}
+
+// add adds c to the batch.
+func (e *Elimination[T, R]) add(c *call[T, R]) {
+	e.calls = append(e.calls, c)
+	e.done = append(e.done, false)
+}
+
+// Len returns the number of elements in the batch.
+func (e *Elimination[T, R]) Len() int { return len(e.calls) }
+
+// Arg returns the i-th element of the batch.
+func (e *Elimination[T, R]) Arg(i int) T { return e.calls[i].arg }
+
+// Complete completes the i-th element with a result,
+// without passing it to ResultBatcher.
+func (e *Elimination[T, R]) Complete(i int, result R, err error) {
+	e.calls[i].result, e.calls[i].err = result, err
+	e.done[i] = true
+}
+
+// Completed returns whether the i-th element has been completed.
+func (e *Elimination[T, R]) Completed(i int) bool { return e.done[i] }
+
+// finishEliminated eliminates elements from the collected batch
+// and applies the remaining ones.
+func (b *resultBatcher[T, R]) finishEliminated() {
+	e := &b.elimination
+	b.eliminate.Eliminate(e)
+
+	started := false
+	for i, c := range e.calls {
+		if e.done[i] {
+			continue
+		}
+		if !started {
+			b.batcher.Start()
+			started = true
+		}
+		b.apply(c)
+	}
+	if started {
+		b.batcher.Finish()
+	}
+	e.reset()
+}
@@ -0,0 +1,140 @@
+package combiner
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+// stackOp pushes value when push is set, otherwise pops.
+type stackOp struct {
+	push  bool
+	value int
+}
+
+var errEmpty = errors.New("empty stack")
+
+type eliminatingStack struct {
+	release chan struct{}
+	values  []int
+	batches int
+}
+
+func (s *eliminatingStack) Start() { s.batches++ }
+
+func (s *eliminatingStack) Do(op stackOp) (int, error) {
+	if op.push {
+		s.values = append(s.values, op.value)
+		return op.value, nil
+	}
+	if len(s.values) == 0 {
+		return 0, errEmpty
+	}
+	v := s.values[len(s.values)-1]
+	s.values = s.values[:len(s.values)-1]
+	return v, nil
+}
+
+func (s *eliminatingStack) Finish() {
+	if s.release != nil {
+		<-s.release
+	}
+}
+
+func (s *eliminatingStack) Eliminate(batch *Elimination[stackOp, int]) {
+	var pushes, pops []int
+	for i := 0; i < batch.Len(); i++ {
+		if batch.Arg(i).push {
+			pushes = append(pushes, i)
+		} else {
+			pops = append(pops, i)
+		}
+	}
+	for len(pushes) > 0 && len(pops) > 0 {
+		push, pop := pushes[0], pops[0]
+		pushes, pops = pushes[1:], pops[1:]
+		value := batch.Arg(push).value
+		batch.Complete(push, value, nil)
+		batch.Complete(pop, value, nil)
+	}
+}
+
+func TestEliminator(t *testing.T) {
+	stack := &eliminatingStack{release: make(chan struct{})}
+	q := NewResult[stackOp, int](stack, 0)
+
+	ops := []stackOp{{push: true, value: 1}, {}, {}, {push: true, value: 2}, {push: true, value: 3}}
+	var popped []int
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	do := func(op stackOp) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := q.Do(op)
+			if err != nil {
+				t.Error(err)
+			}
+			if !op.push {
+				mu.Lock()
+				popped = append(popped, v)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	do(stackOp{push: true, value: 0})
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+	for _, op := range ops {
+		do(op)
+	}
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == uint64(len(ops)) })
+	close(stack.release)
+	wg.Wait()
+
+	if stack.batches != 2 {
+		t.Fatalf("expected 2 batches applied, got %v", stack.batches)
+	}
+	if len(stack.values) != 2 || stack.values[0] != 0 {
+		t.Fatalf("unexpected stack %v", stack.values)
+	}
+
+	all := append(popped, stack.values[1])
+	sort.Ints(all)
+	if len(popped) != 2 || all[0] != 1 || all[1] != 2 || all[2] != 3 {
+		t.Fatalf("unexpected pops %v with stack %v", popped, stack.values)
+	}
+
+}
+
+func TestEliminatorWholeBatch(t *testing.T) {
+	stack := &eliminatingStack{release: make(chan struct{})}
+	q := NewResult[stackOp, int](stack, 0)
+
+	var wg sync.WaitGroup
+	do := func(op stackOp) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := q.Do(op); v != op.value && op.push || err != nil {
+				t.Errorf("unexpected result %v, %v", v, err)
+			}
+		}()
+	}
+
+	do(stackOp{push: true})
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+	do(stackOp{push: true, value: 1})
+	do(stackOp{})
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == 2 })
+	close(stack.release)
+	wg.Wait()
+
+	if stack.batches != 1 || len(stack.values) != 1 {
+		t.Fatalf("expected the stack to be untouched, got %v batches and %v", stack.batches, stack.values)
+	}
+}
@@ -0,0 +1,197 @@
+package combiner
+
+// FairQueue is a combiner queue that shares batches fairly
+// between tenants.
+//
+// When a batch has to be cut at the limit, the elements that fit are
+// chosen using deficit round robin over tenants, and the remaining
+// elements are passed on to the next combiner in the same fair order.
+// This prevents a single tenant from filling every batch.
+type FairQueue[K comparable, T any] struct {
+	queue Queue[tenantElement[K, T]]
+	fair  fairness[K, T]
+}
+
+// tenantElement is an element with its tenant.
+type tenantElement[K comparable, T any] struct {
+	tenant K
+	value  T
+}
+
+// tenantBatcher passes tenant elements to the underlying Batcher.
+type tenantBatcher[K comparable, T any] struct {
+	batcher Batcher[T]
+}
+
+func (b tenantBatcher[K, T]) Start()                      { b.batcher.Start() }
+func (b tenantBatcher[K, T]) Do(elem tenantElement[K, T]) { b.batcher.Do(elem.value) }
+func (b tenantBatcher[K, T]) Finish()                     { b.batcher.Finish() }
+
+// NewFair creates a new fair combiner queue.
+//
+// weight returns the share of a tenant relative to the others,
+// nil means every tenant has a weight of 1.
+func NewFair[K comparable, T any](batcher Batcher[T], limit int, weight func(K) int) *FairQueue[K, T] {
+	q := &FairQueue[K, T]{}
+	q.Init(batcher, limit, weight)
+	return q
+}
+
+// Init initializes a FairQueue combiner.
+// Note: NewFair does this automatically.
+func (q *FairQueue[K, T]) Init(batcher Batcher[T], limit int, weight func(K) int) {
+	q.queue.Init(tenantBatcher[K, T]{batcher}, limit)
+	q.fair.weight = weight
+	q.fair.deficit = map[K]int{}
+	q.queue.schedule = q.fair.schedule
+}
+
+// Do passes value of the tenant to Batcher and waits for completion.
+func (q *FairQueue[K, T]) Do(tenant K, arg T) {
+	q.queue.Do(tenantElement[K, T]{tenant: tenant, value: arg})
+}
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *FairQueue[K, T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *FairQueue[K, T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *FairQueue[K, T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *FairQueue[K, T]) Control() Control { return &q.queue }
+
+// fairness implements deficit round robin scheduling over tenants.
+//
+// It is only used by the combiner, so it does not need locking.
+type fairness[K comparable, T any] struct {
+	weight func(K) int
+
+	// deficit is the unused share of tenants that have
+	// elements left over from the previous cut.
+	deficit map[K]int
+	// next is the tenant whose turn it is.
+	next    K
+	hasNext bool
+
+	groups  []tenantGroup[K, T]
+	ordered []*node[tenantElement[K, T]]
+}
+
+// tenantGroup contains elements of a single tenant in arrival order.
+type tenantGroup[K comparable, T any] struct {
+	tenant K
+	nodes  []*node[tenantElement[K, T]]
+}
+
+// schedule orders the batch when it does not fit into room.
+func (fair *fairness[K, T]) schedule(batch []*node[tenantElement[K, T]], room int) int {
+	if room < 0 || len(batch) <= room {
+		return len(batch)
+	}
+
+	groups := fair.group(batch)
+
+	deficit := make(map[K]int, len(groups))
+	for _, g := range groups {
+		deficit[g.tenant] = fair.deficit[g.tenant]
+	}
+
+	// The first element that does not fit is going to be processed first
+	// by the next combiner, so the state is saved after taking it.
+	cut := room + 1
+
+	ordered := fair.ordered[:0]
+	for len(ordered) < len(batch) {
+		for i := range groups {
+			g := &groups[i]
+			if len(g.nodes) == 0 {
+				continue
+			}
+
+			deficit[g.tenant] += fair.weightOf(g.tenant)
+			for deficit[g.tenant] > 0 && len(g.nodes) > 0 {
+				ordered = append(ordered, g.nodes[0])
+				g.nodes = g.nodes[1:]
+				deficit[g.tenant]--
+				if len(g.nodes) == 0 {
+					deficit[g.tenant] = 0
+				}
+
+				if len(ordered) == cut {
+					turn := i
+					if deficit[g.tenant] == 0 {
+						turn = i + 1
+					}
+					fair.save(groups, turn, deficit)
+				}
+			}
+		}
+	}
+
+	copy(batch, ordered)
+	clear(ordered)
+	fair.ordered = ordered[:0]
+	for i := range groups {
+		groups[i] = tenantGroup[K, T]{}
+	}
+	fair.groups = groups[:0]
+
+	return room
+}
+
+// group splits batch by tenant, starting from the tenant whose turn it is.
+func (fair *fairness[K, T]) group(batch []*node[tenantElement[K, T]]) []tenantGroup[K, T] {
+	groups := fair.groups[:0]
+	index := map[K]int{}
+	for _, n := range batch {
+		tenant := n.argument.tenant
+		i, ok := index[tenant]
+		if !ok {
+			i = len(groups)
+			index[tenant] = i
+			groups = append(groups, tenantGroup[K, T]{tenant: tenant})
+		}
+		groups[i].nodes = append(groups[i].nodes, n)
+	}
+
+	if fair.hasNext {
+		if i, ok := index[fair.next]; ok {
+			rotated := append(groups[i:len(groups):len(groups)], groups[:i]...)
+			copy(groups, rotated)
+		}
+	}
+	return groups
+}
+
+// save remembers the scheduling state at the point where the batch is cut.
+//
+// The turn belongs to the first group starting from groups[turn]
+// that has elements left.
+func (fair *fairness[K, T]) save(groups []tenantGroup[K, T], turn int, deficit map[K]int) {
+	clear(fair.deficit)
+	fair.hasNext = false
+	for i := range groups {
+		g := &groups[(turn+i)%len(groups)]
+		if len(g.nodes) == 0 {
+			continue
+		}
+		fair.deficit[g.tenant] = deficit[g.tenant]
+		if !fair.hasNext {
+			fair.next, fair.hasNext = g.tenant, true
+		}
+	}
+}
+
+// weightOf returns the weight of the tenant.
+func (fair *fairness[K, T]) weightOf(tenant K) int {
+	if fair.weight == nil {
+		return 1
+	}
+	if w := fair.weight(tenant); w > 0 {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package combiner
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+func TestFairQueue(t *testing.T)    { testFairQueue(t, false) }
+func TestFairQueueRun(t *testing.T) { testFairQueue(t, true) }
+
+func testFairQueue(t *testing.T, run bool) {
+	batcher := &batchRecorder{gate: make(chan struct{})}
+	weights := map[string]int{"a": 1, "b": 1, "c": 2}
+	q := NewFair[string, int](batcher, 4, func(tenant string) int { return weights[tenant] })
+	if run {
+		defer startRun(t, &q.queue)()
+	}
+
+	var wg sync.WaitGroup
+	do := func(tenant string, value int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Do(tenant, value)
+		}()
+	}
+
+	do("a", 100)
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+
+	// Add elements one at a time, so that the order is deterministic.
+	pending := 0
+	add := func(tenant string, values ...int) {
+		for _, v := range values {
+			do(tenant, v)
+			pending++
+			testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == uint64(pending) })
+		}
+	}
+	add("a", 1, 2, 3, 4, 5, 6, 7, 8)
+	add("b", 20, 21)
+	add("c", 30, 31, 32, 33)
+
+	close(batcher.gate)
+	wg.Wait()
+
+	got := fmt.Sprint(batcher.batches)
+	expect := "[[100] [1 2 20 30] [31 3 21 32] [33 4 5 6] [7 8]]"
+	if got != expect {
+		t.Fatalf("got %v expected %v", got, expect)
+	}
+}
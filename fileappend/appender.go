@@ -0,0 +1,146 @@
+// Package fileappend implements group commit for appending records to a file.
+//
+// Concurrent appends are combined into a single write followed by
+// a single sync per batch.
+package fileappend
+
+import (
+	"errors"
+	"os"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/internal/syncfile"
+)
+
+// ErrClosed is returned when appending to a closed Appender.
+var ErrClosed = errors.New("fileappend: appender closed")
+
+// Options configures an Appender.
+type Options struct {
+	// Limit is the maximum number of records in a single batch.
+	// Zero means there is no limit.
+	Limit int
+	// Sync makes the written records durable, DataSync when nil.
+	Sync func(f *os.File) error
+}
+
+// Appender appends records to a file.
+//
+// Append can be called concurrently, the records written by concurrent
+// calls are combined into a single write and sync.
+type Appender struct {
+	queue combiner.Queue[*record]
+
+	// The following fields are only used by the combiner.
+
+	out     syncfile.File
+	closed  bool
+	pending []*record
+	buf     []byte
+}
+
+// record is a single Append or Close call.
+type record struct {
+	data   []byte
+	close  bool
+	offset int64
+	err    error
+}
+
+// Open opens or creates the named file for appending.
+func Open(name string, opts Options) (*Appender, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	a, err := New(f, opts)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// New creates an Appender that appends to the end of f.
+//
+// The Appender takes ownership of f, it must not be written by others.
+// f must not be opened with os.O_APPEND, because records are written
+// at their offsets.
+func New(f *os.File, opts Options) (*Appender, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Appender{}
+	a.out = syncfile.File{File: f, Sync: opts.Sync, Size: stat.Size()}
+	if a.out.Sync == nil {
+		a.out.Sync = DataSync
+	}
+	a.queue.Init((*appendBatcher)(a), opts.Limit)
+	return a, nil
+}
+
+// Append writes data at the end of the file and waits until it has
+// been synced. It returns the offset where data was written.
+//
+// When the write fails, data has not been written. When the sync fails,
+// data may or may not be present in the file, and all later appends
+// fail with the same error.
+func (a *Appender) Append(data []byte) (offset int64, err error) {
+	r := &record{data: data}
+	a.queue.Do(r)
+	return r.offset, r.err
+}
+
+// Close syncs and closes the file.
+//
+// Appends after Close fail with ErrClosed.
+func (a *Appender) Close() error {
+	r := &record{close: true}
+	a.queue.Do(r)
+	return r.err
+}
+
+// Stats returns a snapshot of the queue statistics.
+func (a *Appender) Stats() combiner.Stats { return a.queue.Stats() }
+
+// appendBatcher implements combiner.Batcher for Appender.
+type appendBatcher Appender
+
+func (a *appendBatcher) Start() {}
+
+func (a *appendBatcher) Do(r *record) {
+	switch {
+	case a.closed:
+		r.err = ErrClosed
+	case r.close:
+		a.flush()
+		r.err = errors.Join(a.out.Err, a.out.File.Close())
+		a.closed = true
+	case a.out.Err != nil:
+		r.err = a.out.Err
+	default:
+		r.offset = a.out.Size + int64(len(a.buf))
+		a.buf = append(a.buf, r.data...)
+		a.pending = append(a.pending, r)
+	}
+}
+
+func (a *appendBatcher) Finish() { a.flush() }
+
+// flush writes and syncs the pending records.
+func (a *appendBatcher) flush() {
+	if len(a.pending) == 0 {
+		return
+	}
+
+	err := a.out.Append(a.buf)
+	for _, r := range a.pending {
+		r.err = err
+	}
+
+	clear(a.pending)
+	a.pending = a.pending[:0]
+	a.buf = a.buf[:0]
+}
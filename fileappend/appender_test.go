@@ -0,0 +1,131 @@
+package fileappend_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/fileappend"
+)
+
+func TestAppender(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("header\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	syncs := 0
+	a, err := fileappend.Open(name, fileappend.Options{
+		Sync: func(f *os.File) error { syncs++; return fileappend.DataSync(f) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const procs, count = 8, 100
+	offsets := make([][]int64, procs)
+
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				offset, err := a.Append([]byte(fmt.Sprintf("%d:%03d\n", p, i)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				offsets[p] = append(offsets[p], offset)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Append([]byte("x")); !errors.Is(err, fileappend.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := a.Close(); !errors.Is(err, fileappend.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := len("header\n") + procs*count*len("0:000\n"); len(data) != size {
+		t.Fatalf("expected %v bytes, got %v", size, len(data))
+	}
+	for p := range offsets {
+		for i, offset := range offsets[p] {
+			record := []byte(fmt.Sprintf("%d:%03d\n", p, i))
+			if !bytes.Equal(data[offset:offset+int64(len(record))], record) {
+				t.Fatalf("expected %q at %v, got %q", record, offset, data[offset:offset+int64(len(record))])
+			}
+		}
+	}
+
+	if stats := a.Stats(); uint64(syncs) > stats.Batches {
+		t.Fatalf("expected at most one sync per batch, got %v for %v batches", syncs, stats.Batches)
+	}
+}
+
+func TestAppenderSyncError(t *testing.T) {
+	failure := errors.New("sync failed")
+	a, err := fileappend.Open(filepath.Join(t.TempDir(), "data"), fileappend.Options{
+		Sync: func(f *os.File) error { return failure },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed sync leaves the file in an unknown state
+	for i := 0; i < 2; i++ {
+		if _, err := a.Append([]byte("x")); !errors.Is(err, failure) {
+			t.Fatalf("expected sync failure, got %v", err)
+		}
+	}
+	if err := a.Close(); !errors.Is(err, failure) {
+		t.Fatalf("expected sync failure, got %v", err)
+	}
+	if err := a.Close(); !errors.Is(err, fileappend.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestAppenderWriteError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("abc"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := fileappend.New(f, fileappend.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Append([]byte("x")); err == nil {
+		t.Fatal("expected write to a read-only file to fail")
+	}
+	if err := a.Close(); err == nil {
+		t.Fatal("expected close to report the failure")
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" {
+		t.Fatalf("file was modified: %q", data)
+	}
+}
@@ -0,0 +1,15 @@
+package fileappend
+
+import (
+	"os"
+	"syscall"
+)
+
+// DataSync flushes the file data and the metadata needed to read it,
+// using fdatasync.
+func DataSync(f *os.File) error {
+	if err := syscall.Fdatasync(int(f.Fd())); err != nil {
+		return &os.PathError{Op: "fdatasync", Path: f.Name(), Err: err}
+	}
+	return nil
+}
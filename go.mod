@@ -1,3 +1,3 @@
 module loov.dev/combiner
 
-go 1.18
+go 1.21
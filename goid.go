@@ -0,0 +1,59 @@
+package combiner
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// goid returns the id of the current goroutine.
+//
+// It parses the output of runtime.Stack, so it is slow and
+// should only be used for diagnostics.
+func goid() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	id, _ := parseGoroutineHeader(buf[:n])
+	return id
+}
+
+// parseGoroutineHeader parses the id from "goroutine 123 [running]:".
+func parseGoroutineHeader(stack []byte) (int64, bool) {
+	const prefix = "goroutine "
+	if !bytes.HasPrefix(stack, []byte(prefix)) {
+		return 0, false
+	}
+	stack = stack[len(prefix):]
+	end := bytes.IndexByte(stack, ' ')
+	if end < 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(string(stack[:end]), 10, 64)
+	return id, err == nil
+}
+
+// goroutineStack returns the stack of the goroutine with the specified id.
+func goroutineStack(id int64) []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	for len(buf) > 0 {
+		var stack []byte
+		if end := bytes.Index(buf, []byte("\n\n")); end >= 0 {
+			stack, buf = buf[:end], buf[end+2:]
+		} else {
+			stack, buf = buf, nil
+		}
+		if gid, ok := parseGoroutineHeader(stack); ok && gid == id {
+			return stack
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package combiner
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// hybridContention is the number of failed lock attempts
+	// after which Hybrid switches to combining.
+	hybridContention = 4
+	// hybridCalm is the number of consecutive single element batches
+	// after which Hybrid switches back to locking.
+	hybridCalm = 64
+)
+
+// Hybrid is a combiner queue that adapts to contention.
+//
+// Without contention, Hybrid runs each element as its own batch under
+// a mutex, which avoids the overhead of combining. Once it sees
+// goroutines waiting for each other, it switches to combining using
+// a Queue. When batches drop back to single elements, it switches back.
+type Hybrid[T any] struct {
+	mu      sync.Mutex
+	batcher Batcher[T]
+	queue   Queue[T]
+
+	combining  atomic.Bool
+	contention atomic.Int64
+	calm       int64
+
+	uncontended uint64
+	switches    uint64
+}
+
+// hybridBatcher runs the batches of the combining mode.
+//
+// It holds the mutex for the duration of the batch, so that batches
+// never overlap with the lock based path.
+type hybridBatcher[T any] struct {
+	hybrid *Hybrid[T]
+	count  int64
+}
+
+func (b *hybridBatcher[T]) Start() {
+	b.hybrid.mu.Lock()
+	b.count = 0
+	b.hybrid.batcher.Start()
+}
+
+func (b *hybridBatcher[T]) Do(arg T) {
+	b.count++
+	b.hybrid.batcher.Do(arg)
+}
+
+func (b *hybridBatcher[T]) Finish() {
+	b.hybrid.batcher.Finish()
+	b.hybrid.observe(b.count)
+	b.hybrid.mu.Unlock()
+}
+
+// NewHybrid creates a new contention adaptive combiner queue.
+func NewHybrid[T any](batcher Batcher[T], limit int) *Hybrid[T] {
+	q := &Hybrid[T]{}
+	q.Init(batcher, limit)
+	return q
+}
+
+// Init initializes a Hybrid combiner.
+// Note: NewHybrid does this automatically.
+func (q *Hybrid[T]) Init(batcher Batcher[T], limit int) {
+	q.batcher = batcher
+	q.queue.Init(&hybridBatcher[T]{hybrid: q}, limit)
+}
+
+// Do passes value to Batcher and waits for completion.
+func (q *Hybrid[T]) Do(arg T) {
+	if !q.combining.Load() {
+		if q.mu.TryLock() {
+			q.batcher.Start()
+			q.batcher.Do(arg)
+			q.batcher.Finish()
+			atomic.AddUint64(&q.uncontended, 1)
+			q.mu.Unlock()
+			return
+		}
+
+		if q.contention.Add(1) >= hybridContention && q.combining.CompareAndSwap(false, true) {
+			atomic.AddUint64(&q.switches, 1)
+		}
+	}
+	q.queue.Do(arg)
+}
+
+// observe is called with the mutex held after each combined batch.
+func (q *Hybrid[T]) observe(count int64) {
+	if count > 1 {
+		q.calm = 0
+		return
+	}
+
+	q.calm++
+	if q.calm >= hybridCalm && q.combining.Load() {
+		q.calm = 0
+		q.contention.Store(0)
+		q.combining.Store(false)
+		atomic.AddUint64(&q.switches, 1)
+	}
+}
+
+// Combining returns whether the queue is currently combining.
+func (q *Hybrid[T]) Combining() bool { return q.combining.Load() }
+
+// Stats returns a snapshot of the queue statistics.
+//
+// Elements that took the lock based path are counted as
+// single element batches.
+func (q *Hybrid[T]) Stats() Stats {
+	stats := q.queue.Stats()
+	uncontended := atomic.LoadUint64(&q.uncontended)
+	stats.Batches += uncontended
+	stats.Elements += uncontended
+	stats.Uncontended = uncontended
+	stats.ModeSwitches = atomic.LoadUint64(&q.switches)
+	return stats
+}
+
+// Control returns the queue used while combining.
+//
+// Elements that take the lock based path bypass it, so its options
+// and Run only apply to the combining mode.
+func (q *Hybrid[T]) Control() Control { return &q.queue }
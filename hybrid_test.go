@@ -0,0 +1,50 @@
+package combiner_test
+
+import (
+	"sync"
+	"testing"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/internal/testsuite"
+)
+
+func TestHybridSwitching(t *testing.T) {
+	batcher := &blockingFinish{release: make(chan struct{})}
+	q := combiner.NewHybrid[int](batcher, 0)
+
+	var wg sync.WaitGroup
+	do := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Do(1)
+		}()
+	}
+
+	// block the lock based path
+	do()
+	testsuite.WaitUntil(t, func() bool {
+		if q.Combining() {
+			return true
+		}
+		do()
+		return false
+	})
+
+	close(batcher.release)
+	wg.Wait()
+
+	for i := 0; i < 100 && q.Combining(); i++ {
+		q.Do(1)
+	}
+	if q.Combining() {
+		t.Fatal("did not switch back to locking")
+	}
+
+	before := q.Stats()
+	q.Do(1)
+	after := q.Stats()
+	if after.Uncontended != before.Uncontended+1 || after.ModeSwitches != 2 {
+		t.Fatalf("unexpected stats %+v", after)
+	}
+}
@@ -0,0 +1,40 @@
+// Package syncfile implements writing synced batches at the end of a file.
+package syncfile
+
+import "os"
+
+// File appends batches to a file, each with a single write and sync.
+//
+// File is not safe for concurrent use.
+type File struct {
+	File *os.File
+	Sync func(f *os.File) error
+	// Size is the offset of the next batch.
+	Size int64
+	// Err is a failure that leaves the file in an unknown state.
+	// Once it is set, Append fails with it.
+	Err error
+}
+
+// Append writes buf at Size and syncs the file.
+//
+// When the write fails, the partially written data is removed and
+// Append can be retried. When removing it or the sync fails, Err is set,
+// because the data may or may not be present in the file.
+func (f *File) Append(buf []byte) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, err := f.File.WriteAt(buf, f.Size); err != nil {
+		if terr := f.File.Truncate(f.Size); terr != nil {
+			f.Err = err
+		}
+		return err
+	}
+	if err := f.Sync(f.File); err != nil {
+		f.Err = err
+		return err
+	}
+	f.Size += int64(len(buf))
+	return nil
+}
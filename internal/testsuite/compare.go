@@ -0,0 +1,54 @@
+package testsuite
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Find returns the description with the specified name.
+func (descs Descs) Find(name string) Desc {
+	for _, desc := range descs {
+		if desc.Name == name {
+			return desc
+		}
+	}
+	panic("testsuite: unknown combiner " + name)
+}
+
+// Compare runs the Sum benchmark for baseline and candidate
+// with each setup and reports their timings side by side.
+func (params *Params) Compare(baseline, candidate Desc, logf func(format string, args ...interface{})) {
+	wins, total := 0, 0
+	params.Iterate(Descs{baseline}, func(base *Setup) {
+		other := *base
+		other.Name = candidate.Name
+		other.Create = candidate.Create
+		if !candidate.Bounded {
+			other.Bounds = 0
+		}
+
+		baseNs := measureSum(base)
+		otherNs := measureSum(&other)
+
+		verdict := "slower"
+		if otherNs < baseNs {
+			verdict = "faster"
+			wins++
+		}
+		total++
+
+		logf("b%v/p%vs%vi%vr%v: %v %v ns/op, %v %v ns/op, %.2fx %v",
+			base.Bounds, base.Procs, base.WorkStart, base.WorkDo, base.WorkFinish,
+			baseline.Name, baseNs, candidate.Name, otherNs,
+			float64(baseNs)/float64(otherNs), verdict)
+	})
+	logf("%v is faster than %v in %v of %v setups", candidate.Name, baseline.Name, wins, total)
+}
+
+func measureSum(setup *Setup) int64 {
+	result := testing.Benchmark(func(b *testing.B) { benchSum(b, setup) })
+	if result.N == 0 {
+		panic(fmt.Sprintf("testsuite: benchmark %v failed", setup.FullName("Sum")))
+	}
+	return result.NsPerOp()
+}
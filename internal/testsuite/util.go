@@ -1,5 +1,10 @@
 package testsuite
 
+import (
+	"testing"
+	"time"
+)
+
 func StartClose(c Combiner) func() {
 	if r, ok := c.(Runner); ok {
 		go r.Run()
@@ -7,3 +12,15 @@ func StartClose(c Combiner) func() {
 	}
 	return func() {}
 }
+
+// WaitUntil polls check until it succeeds and fails the test
+// when it does not succeed within a second.
+func WaitUntil(t testing.TB, check func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !check(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
@@ -0,0 +1,105 @@
+package combiner
+
+import (
+	"sync"
+	"time"
+)
+
+// Linger decides how long a combiner waits for more elements
+// before finishing a batch.
+type Linger interface {
+	// Linger is called when there are no more waiting elements and
+	// the batch contains count elements. It returns how long to wait.
+	Linger(stats Stats, count int) time.Duration
+}
+
+// FixedLinger waits for a fixed duration.
+type FixedLinger time.Duration
+
+// Linger implements Linger.
+func (linger FixedLinger) Linger(stats Stats, count int) time.Duration {
+	return time.Duration(linger)
+}
+
+// AdaptiveLinger estimates the arrival rate of elements and waits only
+// as long as it expects to gain MinGain elements.
+//
+// When gaining MinGain elements is expected to take longer than MaxDelay,
+// AdaptiveLinger does not wait at all, so low load does not pay for the
+// linger.
+//
+// A single AdaptiveLinger must not be shared between queues.
+type AdaptiveLinger struct {
+	// MaxDelay is the longest time to wait.
+	MaxDelay time.Duration
+	// MinGain is the number of additional elements that make
+	// waiting worthwhile, 1 when zero.
+	MinGain float64
+	// Window is the time over which the arrival rate is averaged,
+	// 100ms when zero.
+	Window time.Duration
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	last     time.Time
+	elements uint64
+	rate     float64 // elements per second
+}
+
+// Linger implements Linger.
+func (linger *AdaptiveLinger) Linger(stats Stats, count int) time.Duration {
+	linger.mu.Lock()
+	defer linger.mu.Unlock()
+
+	now := time.Now
+	if linger.Now != nil {
+		now = linger.Now
+	}
+	rate := linger.observe(now(), stats.Elements)
+	if rate <= 0 {
+		return 0
+	}
+
+	gain := linger.MinGain
+	if gain <= 0 {
+		gain = 1
+	}
+	delay := time.Duration(gain / rate * float64(time.Second))
+	if delay > linger.MaxDelay {
+		return 0
+	}
+	return delay
+}
+
+// Rate returns the estimated arrival rate in elements per second.
+func (linger *AdaptiveLinger) Rate() float64 {
+	linger.mu.Lock()
+	defer linger.mu.Unlock()
+	return linger.rate
+}
+
+// observe updates the arrival rate estimate using the
+// processed element counter.
+func (linger *AdaptiveLinger) observe(now time.Time, elements uint64) float64 {
+	if linger.last.IsZero() {
+		linger.last, linger.elements = now, elements
+		return 0
+	}
+
+	elapsed := now.Sub(linger.last)
+	if elapsed <= 0 {
+		return linger.rate
+	}
+
+	window := linger.Window
+	if window <= 0 {
+		window = 100 * time.Millisecond
+	}
+
+	sample := float64(elements-linger.elements) / elapsed.Seconds()
+	alpha := float64(elapsed) / float64(elapsed+window)
+	linger.rate += alpha * (sample - linger.rate)
+	linger.last, linger.elements = now, elements
+	return linger.rate
+}
@@ -0,0 +1,58 @@
+package combiner_test
+
+import (
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+func TestAdaptiveLinger(t *testing.T) {
+	now := time.Unix(0, 0)
+	linger := &combiner.AdaptiveLinger{
+		MaxDelay: time.Millisecond,
+		Window:   time.Millisecond,
+		Now:      func() time.Time { return now },
+	}
+
+	var stats combiner.Stats
+	step := func(elapsed time.Duration, elements uint64) time.Duration {
+		now = now.Add(elapsed)
+		stats.Elements += elements
+		return linger.Linger(stats, 1)
+	}
+
+	if delay := step(0, 0); delay != 0 {
+		t.Fatalf("expected no delay without estimate, got %v", delay)
+	}
+	if delay := step(time.Millisecond, 100); delay != 20*time.Microsecond {
+		t.Fatalf("expected 20us delay, got %v (rate %v)", delay, linger.Rate())
+	}
+	if delay := step(time.Millisecond, 100); delay != 13333*time.Nanosecond {
+		t.Fatalf("expected 13.333us delay, got %v (rate %v)", delay, linger.Rate())
+	}
+	if delay := step(time.Second, 1); delay != 0 {
+		t.Fatalf("expected no delay at low load, got %v (rate %v)", delay, linger.Rate())
+	}
+}
+
+type countingLinger struct {
+	calls []int
+}
+
+func (linger *countingLinger) Linger(stats combiner.Stats, count int) time.Duration {
+	linger.calls = append(linger.calls, count)
+	return time.Microsecond
+}
+
+func TestQueueLinger(t *testing.T) {
+	linger := &countingLinger{}
+	q := combiner.New[int](&Nop{}, 0)
+	q.Linger = linger
+
+	q.Do(1)
+	q.Do(2)
+	if len(linger.calls) != 2 || linger.calls[0] != 1 {
+		t.Fatalf("unexpected linger calls %v", linger.calls)
+	}
+}
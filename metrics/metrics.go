@@ -0,0 +1,97 @@
+// Package metrics exports combiner queue statistics via expvar and
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"sync"
+
+	"loov.dev/combiner"
+)
+
+// Source is a queue that reports statistics.
+type Source interface {
+	Stats() combiner.Stats
+}
+
+// Registry contains named queues.
+//
+// Registry implements expvar.Var, so it can be published with expvar.Publish.
+type Registry struct {
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// Default is the registry used by Register and Unregister.
+//
+// It is published in expvar as "combiner".
+var Default = NewRegistry()
+
+func init() { expvar.Publish("combiner", Default) }
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{sources: map[string]Source{}}
+}
+
+// Register adds a queue to the Default registry.
+func Register(name string, q Source) { Default.Register(name, q) }
+
+// Unregister removes a queue from the Default registry.
+func Unregister(name string) { Default.Unregister(name) }
+
+// Register adds a named queue to the registry.
+//
+// Register panics when the name is already in use.
+func (r *Registry) Register(name string, q Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.sources[name]; exists {
+		panic("metrics: queue " + name + " already registered")
+	}
+	r.sources[name] = q
+}
+
+// Unregister removes a named queue from the registry.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sources, name)
+}
+
+// Snapshot returns statistics of all registered queues.
+func (r *Registry) Snapshot() map[string]combiner.Stats {
+	r.mu.Lock()
+	sources := make(map[string]Source, len(r.sources))
+	for name, q := range r.sources {
+		sources[name] = q
+	}
+	r.mu.Unlock()
+
+	stats := make(map[string]combiner.Stats, len(sources))
+	for name, q := range sources {
+		stats[name] = q.Stats()
+	}
+	return stats
+}
+
+// String returns the statistics of all registered queues as JSON.
+func (r *Registry) String() string {
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// names returns sorted queue names in the snapshot.
+func names(stats map[string]combiner.Stats) []string {
+	list := make([]string, 0, len(stats))
+	for name := range stats {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
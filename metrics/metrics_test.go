@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/metrics"
+)
+
+type nop struct{}
+
+func (nop) Start()  {}
+func (nop) Do(int)  {}
+func (nop) Finish() {}
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	a := combiner.New[int](nop{}, 0)
+	b := combiner.New[int](nop{}, 0)
+	reg.Register("a", a)
+	reg.Register(`b"\`, b)
+
+	a.Do(1)
+	a.Do(2)
+	b.Do(3)
+
+	var decoded map[string]combiner.Stats
+	if err := json.Unmarshal([]byte(reg.String()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["a"].Elements != 2 || decoded[`b"\`].Elements != 1 {
+		t.Fatalf("unexpected expvar output %v", reg.String())
+	}
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, expect := range []string{
+		"# TYPE combiner_elements_total counter\n",
+		`combiner_elements_total{queue="a"} 2` + "\n",
+		`combiner_elements_total{queue="b\"\\"} 1` + "\n",
+		`combiner_batches_total{queue="a"} 2` + "\n",
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("missing %q in\n%s", expect, body)
+		}
+	}
+
+	reg.Unregister("a")
+	if _, ok := reg.Snapshot()["a"]; ok {
+		t.Fatal("unregister failed")
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"loov.dev/combiner"
+)
+
+// family describes a single exported metric.
+type family struct {
+	name  string
+	kind  string
+	help  string
+	value func(*combiner.Stats) uint64
+}
+
+var families = []family{
+	{
+		name:  "combiner_batches_total",
+		kind:  "counter",
+		help:  "Number of batches started.",
+		value: func(s *combiner.Stats) uint64 { return s.Batches },
+	},
+	{
+		name:  "combiner_elements_total",
+		kind:  "counter",
+		help:  "Number of elements passed to the batcher.",
+		value: func(s *combiner.Stats) uint64 { return s.Elements },
+	},
+	{
+		name:  "combiner_handoffs_total",
+		kind:  "counter",
+		help:  "Number of batches cut at the limit.",
+		value: func(s *combiner.Stats) uint64 { return s.Handoffs },
+	},
+	{
+		name:  "combiner_overloaded_total",
+		kind:  "counter",
+		help:  "Number of elements rejected because the queue was overloaded.",
+		value: func(s *combiner.Stats) uint64 { return s.Overloaded },
+	},
+	{
+		name:  "combiner_withdrawn_total",
+		kind:  "counter",
+		help:  "Number of elements withdrawn by TryDo.",
+		value: func(s *combiner.Stats) uint64 { return s.Withdrawn },
+	},
+	{
+		name:  "combiner_uncontended_total",
+		kind:  "counter",
+		help:  "Number of elements processed without combining.",
+		value: func(s *combiner.Stats) uint64 { return s.Uncontended },
+	},
+	{
+		name:  "combiner_mode_switches_total",
+		kind:  "counter",
+		help:  "Number of switches between locking and combining.",
+		value: func(s *combiner.Stats) uint64 { return s.ModeSwitches },
+	},
+	{
+		name:  "combiner_pending",
+		kind:  "gauge",
+		help:  "Approximate number of unprocessed elements.",
+		value: func(s *combiner.Stats) uint64 { return s.Pending },
+	},
+}
+
+// Handler returns a handler that serves the statistics of the Default registry
+// in Prometheus text exposition format.
+func Handler() http.Handler { return Default.Handler() }
+
+// Handler returns a handler that serves the statistics
+// in Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the statistics in Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	stats := r.Snapshot()
+	queues := names(stats)
+
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		out.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		out.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+		for _, name := range queues {
+			s := stats[name]
+			out.WriteString(f.name + `{queue="` + escapeLabel(name) + `"} `)
+			out.WriteString(strconv.FormatUint(f.value(&s), 10))
+			out.WriteString("\n")
+		}
+	}
+	return out.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
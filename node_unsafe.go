@@ -9,6 +9,7 @@ type nodeptr = uintptr
 
 type node[T any] struct {
 	next     nodeptr // *next
+	state    uint32  // nodeClaimed or nodeWithdrawn, only used with TryDo
 	argument T
 }
 
@@ -19,6 +20,23 @@ const (
 	handoffTag = nodeptr(2)
 )
 
+const (
+	nodeClaimed   = 1
+	nodeWithdrawn = 2
+)
+
+// claim marks the node as taken by a combiner,
+// it fails when the node has been withdrawn.
+func (n *node[T]) claim() bool {
+	return atomic.CompareAndSwapUint32(&n.state, 0, nodeClaimed)
+}
+
+// withdraw marks the node as withdrawn,
+// it fails when the node has been claimed by a combiner.
+func (n *node[T]) withdraw() bool {
+	return atomic.CompareAndSwapUint32(&n.state, 0, nodeWithdrawn)
+}
+
 func atomicLoadNodeptr(p *nodeptr) nodeptr {
 	return atomic.LoadUintptr(p)
 }
@@ -30,4 +48,11 @@ func atomicCompareAndSwapNodeptr(addr *uintptr, old, new uintptr) bool {
 	return atomic.CompareAndSwapUintptr(addr, old, new)
 }
 
+// nodeptrToNode converts nodeptr back to a node.
+//
+// Nodes are kept alive by their waiting goroutines, or by Queue.abandoned
+// when withdrawn by TryDo, so the conversion is safe as long as the node
+// is linked.
+//
+//go:nocheckptr
 func nodeptrToNode[T any](p nodeptr) *node[T] { return (*node[T])(unsafe.Pointer(p)) }
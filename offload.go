@@ -0,0 +1,167 @@
+package combiner
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Run processes batches on the calling goroutine until Close is called.
+//
+// While Run holds the combiner role, callers of Do only add their value
+// to the queue and park until it has been processed, so no caller pays
+// for the work of the others. When another goroutine is combining at the
+// time Run is called, the combiner role is passed to Run after that batch.
+//
+// Close stops Run after the waiting values have been processed. After that
+// the queue continues to work with callers combining themselves.
+// Run must not be called concurrently or after Close.
+func (q *Queue[T]) Run() {
+	r := &runner{
+		wake:     make(chan struct{}, 1),
+		passed:   make(chan nodeptr, 1),
+		closing:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	if !q.runner.CompareAndSwap(nil, r) {
+		panic("combiner: Run called concurrently")
+	}
+	defer func() {
+		q.runner.Store(nil)
+		close(r.finished)
+	}()
+	if q.closed.Load() {
+		return
+	}
+
+	list, ok := q.acquire(r)
+	if !ok {
+		return
+	}
+
+	for {
+		// Lists passed on by a combiner or left over from a batch are
+		// in processing order, unlike the ones grabbed from the queue.
+		chained := list != locked
+		if !chained {
+			list = q.grab()
+		}
+		if list != locked {
+			list = q.runBatch(list, chained)
+			continue
+		}
+
+		select {
+		case <-r.wake:
+		case <-r.closing:
+			if atomicCompareAndSwapNodeptr(&q.head, locked, 0) {
+				return
+			}
+		}
+	}
+}
+
+// Close stops Run and waits for it to return. It also stops
+// the watchdog started with StartWatchdog.
+//
+// Close can be called on a queue that is not running.
+func (q *Queue[T]) Close() {
+	q.closed.Store(true)
+	if r := q.runner.Load(); r != nil {
+		r.stop()
+		<-r.finished
+	}
+	if watch := q.watch.Load(); watch != nil {
+		watch.stop()
+	}
+}
+
+// acquire waits until Run gets the combiner role,
+// either from an idle queue or passed on by a combiner.
+//
+// acquire returns the list of operations passed on with the role,
+// or false when Close was called before that.
+func (q *Queue[T]) acquire(r *runner) (nodeptr, bool) {
+	for {
+		if atomicCompareAndSwapNodeptr(&q.head, 0, locked) {
+			// There is no combiner that could pass on the role.
+			r.state.Store(runnerActive)
+			return locked, true
+		}
+
+		select {
+		case list := <-r.passed:
+			return list, true
+		case <-r.wake:
+		case <-r.closing:
+			if r.state.CompareAndSwap(runnerWaiting, runnerStopped) {
+				return 0, false
+			}
+			return <-r.passed, true
+		}
+	}
+}
+
+// runBatch processes a batch from list, returns the remaining list.
+//
+// When chained is set, list is already in processing order.
+func (q *Queue[T]) runBatch(list nodeptr, chained bool) nodeptr {
+	if q.schedule != nil {
+		chain, fresh := locked, list
+		if chained {
+			// Newly added operations may need to go before the chain.
+			chain, fresh = list, q.grab()
+		}
+		list, _ = q.scheduleList(chain, fresh, -1)
+		if list == locked {
+			// All of them were withdrawn.
+			return locked
+		}
+	}
+	own := q.claimRest(nodeptrToNode[T](list))
+	if own == nil {
+		return locked
+	}
+	return q.run(own.argument, own.next, true, own)
+}
+
+const (
+	runnerWaiting = iota
+	runnerActive
+	runnerStopped
+)
+
+// runner is the state of Run.
+type runner struct {
+	state atomic.Int32
+	// wake is signalled when operations are added to an empty list
+	// or when the queue becomes idle.
+	wake chan struct{}
+	// passed receives the list of operations from the combiner
+	// that passes the combiner role to Run.
+	passed chan nodeptr
+
+	closing  chan struct{}
+	once     sync.Once
+	finished chan struct{}
+}
+
+// signal wakes up Run.
+func (r *runner) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// handover passes the combiner role and list to Run,
+// when it is waiting to acquire it.
+func (r *runner) handover(list nodeptr) bool {
+	if !r.state.CompareAndSwap(runnerWaiting, runnerActive) {
+		return false
+	}
+	r.passed <- list
+	return true
+}
+
+// stop asks Run to return.
+func (r *runner) stop() { r.once.Do(func() { close(r.closing) }) }
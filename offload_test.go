@@ -0,0 +1,113 @@
+package combiner
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+// goroutineRecorder records the goroutines that run batches.
+type goroutineRecorder struct {
+	gate       chan struct{}
+	goroutines map[int64]int
+}
+
+func (b *goroutineRecorder) Start() {}
+func (b *goroutineRecorder) Do(int) {}
+
+func (b *goroutineRecorder) Finish() {
+	if b.gate != nil {
+		<-b.gate
+		b.gate = nil
+	}
+	b.goroutines[goid()]++
+}
+
+// startRun starts Run on q and waits until it holds the combiner role.
+// The returned func closes q and waits for Run to return.
+func startRun[T any](t *testing.T, q *Queue[T]) (stop func()) {
+	ran := make(chan struct{})
+	go func() {
+		q.Run()
+		close(ran)
+	}()
+	testsuite.WaitUntil(t, func() bool { return q.runner.Load() != nil && q.runner.Load().state.Load() == runnerActive })
+	return func() {
+		q.Close()
+		<-ran
+	}
+}
+
+func TestOffload(t *testing.T) {
+	batcher := &goroutineRecorder{goroutines: map[int64]int{}}
+	q := New[int](batcher, 4)
+
+	var runner atomic.Int64
+	ran := make(chan struct{})
+	go func() {
+		runner.Store(goid())
+		q.Run()
+		close(ran)
+	}()
+	testsuite.WaitUntil(t, func() bool { return q.runner.Load() != nil && q.runner.Load().state.Load() == runnerActive })
+
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				q.Do(i)
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	<-ran
+
+	if len(batcher.goroutines) != 1 || batcher.goroutines[runner.Load()] == 0 {
+		t.Fatalf("expected all batches to run on Run goroutine, got %v", batcher.goroutines)
+	}
+
+	// after Close callers combine themselves
+	q.Do(1)
+	if len(batcher.goroutines) != 2 {
+		t.Fatalf("expected caller to combine after Close, got %v", batcher.goroutines)
+	}
+}
+
+func TestOffloadPassedRole(t *testing.T) {
+	batcher := &goroutineRecorder{gate: make(chan struct{}), goroutines: map[int64]int{}}
+	q := New[int](batcher, 0)
+
+	done := make(chan struct{})
+	go func() { q.Do(0); close(done) }()
+	testsuite.WaitUntil(t, func() bool { return atomicLoadNodeptr(&q.head) != 0 })
+
+	ran := make(chan struct{})
+	go func() { q.Run(); close(ran) }()
+	testsuite.WaitUntil(t, func() bool { return q.runner.Load() != nil })
+
+	waiting := make(chan struct{})
+	go func() { q.Do(1); close(waiting) }()
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == 1 })
+
+	close(batcher.gate)
+	<-done
+	<-waiting
+	if batches := len(batcher.goroutines); batches != 2 {
+		t.Fatalf("expected the second batch to run on Run goroutine, got %v", batcher.goroutines)
+	}
+
+	q.Close()
+	<-ran
+}
+
+func TestOffloadCloseBeforeRun(t *testing.T) {
+	q := New[int](&goroutineRecorder{goroutines: map[int64]int{}}, 0)
+	q.Close()
+	q.Run()
+	q.Do(1)
+}
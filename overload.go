@@ -0,0 +1,40 @@
+package combiner
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrOverloaded is returned when the queue already holds
+// MaxPending unprocessed elements.
+var ErrOverloaded = errors.New("combiner: queue overloaded")
+
+// DoContext passes value to Batcher and waits for completion.
+//
+// Unlike Do, DoContext returns an error without adding the value to the
+// queue when ctx is already done or when the queue is overloaded.
+// Once the value has been added, DoContext waits for its completion
+// even when ctx is cancelled.
+func (q *Queue[T]) DoContext(ctx context.Context, arg T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if q.overloaded() {
+		return ErrOverloaded
+	}
+	q.Do(arg)
+	return nil
+}
+
+// overloaded checks whether the queue holds MaxPending elements.
+//
+// The pending counter is approximate, so a few more elements may get
+// linked in when many goroutines check it at the same time.
+func (q *Queue[T]) overloaded() bool {
+	if q.MaxPending <= 0 || q.pending.Load() < int64(q.MaxPending) {
+		return false
+	}
+	atomic.AddUint64(&q.stats.overloaded, 1)
+	return true
+}
@@ -0,0 +1,50 @@
+package combiner_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/internal/testsuite"
+)
+
+func TestMaxPending(t *testing.T) {
+	batcher := &blockingFinish{release: make(chan struct{})}
+	q := combiner.New[int](batcher, 0)
+	q.MaxPending = 2
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer wg.Done()
+			if err := q.DoContext(ctx, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+		// wait for the combiner and then the waiters
+		testsuite.WaitUntil(t, func() bool { return q.Stats().Pending >= uint64(i) })
+	}
+
+	if err := q.DoContext(ctx, 1); !errors.Is(err, combiner.ErrOverloaded) {
+		t.Fatalf("expected overload, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := q.DoContext(cancelled, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+
+	close(batcher.release)
+	wg.Wait()
+
+	stats := q.Stats()
+	if stats.Pending != 0 || stats.Overloaded != 1 || stats.Elements != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
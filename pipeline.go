@@ -0,0 +1,118 @@
+package combiner
+
+// PipelinedBatcher is the operation combining implementation
+// with a two phase finish, such as writing and syncing a file.
+//
+// Flush is called while holding the combiner role. Commit is called
+// after the role has been passed on, so it may run concurrently with
+// Start, Do and Flush of the next batch. Commit calls are never
+// concurrent with each other and are made in the batch order.
+//
+// PipelinedBatcher must not panic.
+type PipelinedBatcher[T any] interface {
+	// Start is called on a start of a new batch.
+	Start()
+	// Do is called for each batch element.
+	Do(T)
+	// Flush is called after the last element of a batch.
+	Flush()
+	// Commit is called after Flush, once the previous batch
+	// has been committed.
+	Commit()
+}
+
+// PipelinedQueue is a combiner queue that overlaps committing a batch
+// with collecting the next one.
+//
+// Do returns after the batch containing the value has been committed.
+type PipelinedQueue[T any] struct {
+	queue   Queue[*pipelined[T]]
+	batcher pipelineBatcher[T]
+}
+
+// pipelined is an element with the commit of its batch.
+type pipelined[T any] struct {
+	arg    T
+	commit *pipelineCommit
+	// leader is set for the element of the combiner,
+	// which is responsible for committing the batch.
+	leader bool
+}
+
+// pipelineCommit tracks committing a single batch.
+type pipelineCommit struct {
+	prev *pipelineCommit
+	done chan struct{}
+}
+
+// pipelineBatcher passes elements to PipelinedBatcher.
+type pipelineBatcher[T any] struct {
+	batcher PipelinedBatcher[T]
+	current *pipelineCommit
+	last    *pipelineCommit
+	first   bool
+}
+
+func (b *pipelineBatcher[T]) Start() {
+	b.current = &pipelineCommit{prev: b.last, done: make(chan struct{})}
+	b.first = true
+	b.batcher.Start()
+}
+
+func (b *pipelineBatcher[T]) Do(e *pipelined[T]) {
+	// The combiner always processes its own element first.
+	e.leader, b.first = b.first, false
+	e.commit = b.current
+	b.batcher.Do(e.arg)
+}
+
+func (b *pipelineBatcher[T]) Finish() {
+	b.batcher.Flush()
+	b.last, b.current = b.current, nil
+}
+
+// NewPipelined creates a new pipelined combiner queue.
+func NewPipelined[T any](batcher PipelinedBatcher[T], limit int) *PipelinedQueue[T] {
+	q := &PipelinedQueue[T]{}
+	q.Init(batcher, limit)
+	return q
+}
+
+// Init initializes a PipelinedQueue combiner.
+// Note: NewPipelined does this automatically.
+func (q *PipelinedQueue[T]) Init(batcher PipelinedBatcher[T], limit int) {
+	q.batcher.batcher = batcher
+	q.queue.Init(&q.batcher, limit)
+}
+
+// Do passes value to PipelinedBatcher and waits until
+// the batch containing it has been committed.
+func (q *PipelinedQueue[T]) Do(arg T) {
+	e := &pipelined[T]{arg: arg}
+	q.queue.Do(e)
+
+	c := e.commit
+	if !e.leader {
+		<-c.done
+		return
+	}
+
+	if c.prev != nil {
+		<-c.prev.done
+		c.prev = nil
+	}
+	q.batcher.batcher.Commit()
+	close(c.done)
+}
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *PipelinedQueue[T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *PipelinedQueue[T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *PipelinedQueue[T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *PipelinedQueue[T]) Control() Control { return &q.queue }
@@ -0,0 +1,98 @@
+package combiner_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+type pipelineRecorder struct {
+	batch   []int
+	flushed chan []int
+	gate    chan struct{}
+
+	mu        sync.Mutex
+	committed int
+}
+
+func (b *pipelineRecorder) Start()   { b.batch = nil }
+func (b *pipelineRecorder) Do(v int) { b.batch = append(b.batch, v) }
+func (b *pipelineRecorder) Flush()   { b.flushed <- b.batch }
+
+func (b *pipelineRecorder) Commit() {
+	<-b.gate
+	b.mu.Lock()
+	b.committed++
+	b.mu.Unlock()
+}
+
+func (b *pipelineRecorder) commits() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed
+}
+
+func TestPipelinedQueue(t *testing.T) {
+	batcher := &pipelineRecorder{flushed: make(chan []int, 2), gate: make(chan struct{})}
+	q := combiner.NewPipelined[int](batcher, 0)
+
+	done := make(chan int, 2)
+	go func() { q.Do(1); done <- 1 }()
+	<-batcher.flushed
+
+	// the first batch is committing, the second batch can still be flushed
+	go func() { q.Do(2); done <- 2 }()
+	select {
+	case <-batcher.flushed:
+	case <-time.After(time.Second):
+		t.Fatal("second batch was not flushed during commit")
+	}
+
+	select {
+	case v := <-done:
+		t.Fatalf("Do(%v) returned before commit", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	batcher.gate <- struct{}{}
+	if v := <-done; v != 1 {
+		t.Fatalf("expected the first batch to complete first, got %v", v)
+	}
+	select {
+	case v := <-done:
+		t.Fatalf("Do(%v) returned before commit", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	batcher.gate <- struct{}{}
+	<-done
+
+	if commits := batcher.commits(); commits != 2 {
+		t.Fatalf("expected 2 commits, got %v", commits)
+	}
+}
+
+func TestPipelinedQueueConcurrent(t *testing.T) {
+	batcher := &pipelineRecorder{flushed: make(chan []int, 1<<20), gate: make(chan struct{})}
+	close(batcher.gate)
+	q := combiner.NewPipelined[int](batcher, 8)
+
+	const procs, count = 8, 500
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				q.Do(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats, commits := q.Stats(), batcher.commits(); uint64(commits) != stats.Batches {
+		t.Fatalf("expected %v commits, got %v", stats.Batches, commits)
+	}
+}
@@ -0,0 +1,93 @@
+package combiner
+
+import "sort"
+
+// PriorityQueue is a combiner queue with multiple priority lanes.
+//
+// Each batch processes elements in lane order, lane 0 being the most
+// urgent. When a batch reaches the limit, only elements from lanes other
+// than 0 are left for the next combiner, so urgent elements never wait
+// behind a backlog of less urgent ones.
+//
+// The element of the goroutine that becomes the combiner is always
+// processed first.
+type PriorityQueue[T any] struct {
+	queue Queue[laneElement[T]]
+	lanes int
+}
+
+// laneElement is an element with its lane.
+type laneElement[T any] struct {
+	lane  int
+	value T
+}
+
+// laneBatcher passes lane elements to the underlying Batcher.
+type laneBatcher[T any] struct {
+	batcher Batcher[T]
+}
+
+func (b laneBatcher[T]) Start()                 { b.batcher.Start() }
+func (b laneBatcher[T]) Do(elem laneElement[T]) { b.batcher.Do(elem.value) }
+func (b laneBatcher[T]) Finish()                { b.batcher.Finish() }
+
+// NewPriority creates a new priority combiner queue.
+func NewPriority[T any](batcher Batcher[T], lanes, limit int) *PriorityQueue[T] {
+	q := &PriorityQueue[T]{}
+	q.Init(batcher, lanes, limit)
+	return q
+}
+
+// Init initializes a PriorityQueue combiner.
+// Note: NewPriority does this automatically.
+func (q *PriorityQueue[T]) Init(batcher Batcher[T], lanes, limit int) {
+	if lanes < 1 {
+		panic("combiner needs at least one lane")
+	}
+	q.lanes = lanes
+	q.queue.Init(laneBatcher[T]{batcher}, limit)
+	q.queue.schedule = scheduleLanes[T]
+}
+
+// Do passes value to Batcher in the specified lane and waits for completion.
+func (q *PriorityQueue[T]) Do(lane int, arg T) {
+	if lane < 0 || lane >= q.lanes {
+		panic("combiner lane out of range")
+	}
+	q.queue.Do(laneElement[T]{lane: lane, value: arg})
+}
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *PriorityQueue[T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *PriorityQueue[T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *PriorityQueue[T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *PriorityQueue[T]) Control() Control { return &q.queue }
+
+// scheduleLanes orders batch by lane and takes all elements from lane 0
+// and as many others as fit in room.
+func scheduleLanes[T any](batch []*node[laneElement[T]], room int) int {
+	sort.SliceStable(batch, func(i, k int) bool {
+		return batch[i].argument.lane < batch[k].argument.lane
+	})
+	if room < 0 {
+		return len(batch)
+	}
+
+	urgent := 0
+	for urgent < len(batch) && batch[urgent].argument.lane == 0 {
+		urgent++
+	}
+	if room < urgent {
+		room = urgent
+	}
+	if room > len(batch) {
+		room = len(batch)
+	}
+	return room
+}
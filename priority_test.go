@@ -0,0 +1,63 @@
+package combiner
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+type batchRecorder struct {
+	gate    chan struct{}
+	current []int
+	batches [][]int
+}
+
+func (b *batchRecorder) Start()     { b.current = nil }
+func (b *batchRecorder) Do(arg int) { b.current = append(b.current, arg) }
+func (b *batchRecorder) Finish() {
+	b.batches = append(b.batches, b.current)
+	if b.gate != nil {
+		<-b.gate
+		b.gate = nil
+	}
+}
+
+func TestPriorityQueue(t *testing.T)    { testPriorityQueue(t, false) }
+func TestPriorityQueueRun(t *testing.T) { testPriorityQueue(t, true) }
+
+func testPriorityQueue(t *testing.T, run bool) {
+	batcher := &batchRecorder{gate: make(chan struct{})}
+	q := NewPriority[int](batcher, 2, 3)
+	if run {
+		defer startRun(t, &q.queue)()
+	}
+
+	var wg sync.WaitGroup
+	do := func(lane, value int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Do(lane, value)
+		}()
+	}
+
+	do(1, 100)
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+
+	// Add elements one at a time, so that the order is deterministic.
+	for i, elem := range [][2]int{{1, 1}, {1, 2}, {1, 3}, {0, 50}, {1, 4}, {0, 51}, {0, 52}, {1, 5}, {1, 6}, {0, 53}} {
+		do(elem[0], elem[1])
+		testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == uint64(i+1) })
+	}
+
+	close(batcher.gate)
+	wg.Wait()
+
+	got := fmt.Sprint(batcher.batches)
+	expect := "[[100] [50 51 52 53] [1 2 3] [4 5 6]]"
+	if got != expect {
+		t.Fatalf("got %v expected %v", got, expect)
+	}
+}
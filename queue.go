@@ -1,8 +1,11 @@
 package combiner
 
 import (
-	"runtime"
+	"context"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Batcher is the operation combining implementation.
@@ -30,6 +33,54 @@ type Queue[T any] struct {
 	_       [7]int64
 	lock    sync.Mutex
 	cond    sync.Cond
+	stats   queueStats
+	watch   atomic.Pointer[batchWatch]
+	reenter reentrancy[T]
+	nodes   sync.Pool
+	tuner   atomic.Pointer[tuner]
+	pending atomic.Int64
+	runner  atomic.Pointer[runner]
+	closed  atomic.Bool
+
+	// tries is set once TryDo has been used. Nodes withdrawn by TryDo
+	// are kept alive in abandoned until a combiner releases them.
+	tries       atomic.Bool
+	abandonLock sync.Mutex
+	abandoned   map[*node[T]]struct{}
+
+	// schedule, when set, reorders each list of operations before
+	// processing; see scheduleList.
+	schedule func(batch []*node[T], room int) int
+	batch    []*node[T]
+
+	QueueOptions
+}
+
+// QueueOptions configures a Queue.
+//
+// The options must be set before the queue is used.
+type QueueOptions struct {
+	// Name identifies the queue in profiles.
+	Name string
+	// ProfileLabels enables pprof labels combiner=<Name> and role=combiner
+	// on the goroutine while it is running a batch. This makes the batched
+	// work show up separately from the caller that became the combiner.
+	ProfileLabels bool
+	// Reentrancy controls detection of Do calls made from the Batcher.
+	// Detecting them requires looking up the goroutine id in each Do,
+	// which is slow.
+	Reentrancy Reentrancy
+	// MaxBatchDuration limits how long a single combiner processes elements.
+	// When it is exceeded, the batch is finished and the remaining elements
+	// are passed on to another combiner, the same way as when hitting
+	// the limit. Zero means no limit.
+	MaxBatchDuration time.Duration
+	// Linger decides how long the combiner waits for more elements
+	// before finishing a batch. Nil means no waiting.
+	Linger Linger
+	// MaxPending is the number of unprocessed elements after which
+	// DoContext returns ErrOverloaded. Zero means no limit.
+	MaxPending int
 }
 
 // New creates a new combiner queue
@@ -51,114 +102,373 @@ func (q *Queue[T]) Init(batcher Batcher[T], limit int) {
 	q.cond.L = &q.lock
 }
 
+// Limit returns the maximum number of elements in a single batch.
+// Zero means there is no limit.
+func (q *Queue[T]) Limit() int { return int(atomic.LoadInt64(&q.limit)) }
+
+// SetLimit changes the maximum number of elements in a single batch.
+// Zero means there is no limit.
+//
+// SetLimit can be called concurrently with Do, the new limit is used
+// starting from the next batch.
+func (q *Queue[T]) SetLimit(limit int) {
+	if limit < 0 {
+		panic("combiner limit must be positive")
+	}
+	atomic.StoreInt64(&q.limit, int64(limit))
+}
+
 // Do passes value to Batcher and waits for completion
-//go:nosplit
+//
+// Do returns after Batcher.Finish has been called for the batch
+// containing the value.
+//
 //go:noinline
 func (q *Queue[T]) Do(arg T) {
-	var mynode node[T]
-	my := &mynode
-	my.argument = arg
-	defer runtime.KeepAlive(my)
+	if q.Reentrancy != ReentrancyIgnore && q.reentrant(arg) {
+		return
+	}
+	if tuner := q.tuner.Load(); tuner != nil {
+		start := time.Now()
+		defer tuner.observeLatency(start)
+	}
+
+	my := q.link(arg)
+	if my == nil {
+		q.run(arg, locked, false, nil)
+		return
+	}
 
-	var cmp nodeptr
+	if q.wait(my) {
+		q.run(my.argument, my.next, true, nil)
+	}
+	q.freeNode(my)
+}
+
+// link adds arg to the list of waiting operations.
+//
+// link returns nil, when the queue was idle and the caller
+// became the combiner instead.
+func (q *Queue[T]) link(arg T) *node[T] {
+	var my *node[T]
 	for {
-		cmp = atomicLoadNodeptr(&q.head)
+		cmp := atomicLoadNodeptr(&q.head)
 		xchg := locked
 		if cmp != 0 {
+			if my == nil {
+				my = q.newNode(arg)
+			}
 			xchg = my.ref()
 			my.next = cmp
 		}
 		if atomicCompareAndSwapNodeptr(&q.head, cmp, xchg) {
-			break
-		}
-	}
-
-	handoff := false
-	if cmp != 0 {
-		// busy wait
-		for i := 0; i < 8; i++ {
-			next := atomicLoadNodeptr(&my.next)
-			if next == 0 {
-				return
+			if cmp == 0 {
+				if my != nil {
+					q.freeNode(my)
+				}
+				return nil
 			}
-			if next&handoffTag != 0 {
-				my.next &^= handoffTag
-				handoff = true
-				goto combining
+			q.pending.Add(1)
+			if cmp == locked {
+				if r := q.runner.Load(); r != nil {
+					r.signal()
+				}
 			}
+			return my
 		}
+	}
+}
 
-		q.lock.Lock()
-		for {
-			next := atomicLoadNodeptr(&my.next)
-			if next == 0 {
-				q.lock.Unlock()
-				return
-			}
-			if next&handoffTag != 0 {
-				my.next &^= handoffTag
-				handoff = true
-				q.lock.Unlock()
-				goto combining
-			}
+// wait waits until my has been processed or handed off.
+//
+// wait returns true when my has been handed off and the caller
+// must continue combining.
+func (q *Queue[T]) wait(my *node[T]) bool {
+	if done, handoff := q.spin(my); done {
+		return handoff
+	}
 
-			q.cond.Wait()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		if done, handoff := poll(my); done {
+			return handoff
 		}
+		q.cond.Wait()
 	}
+}
 
-combining:
+// spin busy waits for my to be processed or handed off.
+func (q *Queue[T]) spin(my *node[T]) (done, handoff bool) {
+	for i := 0; i < 8; i++ {
+		if done, handoff := poll(my); done {
+			return done, handoff
+		}
+	}
+	return false, false
+}
+
+// poll checks whether my has been processed or handed off.
+func poll[T any](my *node[T]) (done, handoff bool) {
+	next := atomicLoadNodeptr(&my.next)
+	if next == 0 {
+		return true, false
+	}
+	if next&handoffTag != 0 {
+		my.next &^= handoffTag
+		return true, true
+	}
+	return false, false
+}
+
+// newNode returns a node for linking arg into the list.
+//
+// Nodes are referenced by their address, so they are allocated on the heap
+// instead of the stack, which may move while the node is linked.
+func (q *Queue[T]) newNode(arg T) *node[T] {
+	my, _ := q.nodes.Get().(*node[T])
+	if my == nil {
+		my = &node[T]{}
+	}
+	my.argument = arg
+	return my
+}
+
+// freeNode releases a node after it has been processed.
+func (q *Queue[T]) freeNode(my *node[T]) {
+	*my = node[T]{}
+	q.nodes.Put(my)
+}
+
+// run executes the batch starting with arg.
+func (q *Queue[T]) run(arg T, cmp nodeptr, handoff bool, own *node[T]) (rest nodeptr) {
+	if q.ProfileLabels {
+		return q.combineLabeled(arg, cmp, handoff, own)
+	}
+	return q.combine(arg, cmp, handoff, own)
+}
+
+// combineLabeled runs combine with the profile labels applied.
+func (q *Queue[T]) combineLabeled(arg T, cmp nodeptr, handoff bool, own *node[T]) (rest nodeptr) {
+	labels := pprof.Labels("combiner", q.Name, "role", "combiner")
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		rest = q.combine(arg, cmp, handoff, own)
+	})
+	return rest
+}
+
+// combine executes arg and the combined operations.
+//
+// When handoff is true, cmp is the list of remaining operations
+// passed on by the previous combiner.
+//
+// The combiner role is held until the batch has finished, so that
+// Batcher calls are never concurrent. Waiters are released after
+// Batcher.Finish has returned.
+//
+// When own is not nil, combine runs on behalf of Run: own is the node
+// of arg, which is released together with the others, and the combiner
+// role is kept. combine then returns the list of remaining operations.
+func (q *Queue[T]) combine(arg T, cmp nodeptr, handoff bool, own *node[T]) nodeptr {
+	watch := q.watch.Load()
+	if watch != nil {
+		watch.begin()
+	}
+
+	limit := atomic.LoadInt64(&q.limit)
+
+	var start, deadline time.Time
+	tuner := q.tuner.Load()
+	if tuner != nil || q.MaxBatchDuration > 0 {
+		start = time.Now()
+	}
+	if q.MaxBatchDuration > 0 {
+		deadline = start.Add(q.MaxBatchDuration)
+	}
+
+	q.enter()
 	q.batcher.Start()
-	q.batcher.Do(my.argument)
+	q.batcher.Do(arg)
 	count := int64(1)
+	inline := q.doInline()
 
-	if handoff {
-		goto combine
+	// Processed nodes are chained from first to last through next,
+	// rest is the first node that did not fit into the batch.
+	var first, last, rest *node[T]
+	first, last = own, own
+
+	// chained is set while cmp is the list passed on by the previous combiner.
+	chained := handoff && cmp != locked
+	lingered := false
+	if !chained {
+		cmp = q.grab()
 	}
 
-combinecheck:
+	// Execute the list of operations.
 	for {
-		cmp = atomicLoadNodeptr(&q.head)
-		var xchg uintptr = 0
-		if cmp != locked {
-			xchg = locked
+		if cmp == locked && !lingered && q.Linger != nil && count != limit {
+			// Wait once per batch for more operations to arrive.
+			lingered = true
+			if delay := q.Linger.Linger(q.Stats(), int(count)); delay > 0 {
+				time.Sleep(delay)
+				cmp = q.grab()
+			}
+		}
+		if cmp == locked {
+			break
 		}
 
-		if atomicCompareAndSwapNodeptr(&q.head, cmp, xchg) {
+		if q.schedule != nil {
+			room := -1
+			if limit > 0 {
+				room = int(limit - count)
+			}
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				room = 0
+			}
+			chain, fresh := locked, cmp
+			if chained {
+				// The handed off list is already in order, but newly
+				// added operations may need to go before it.
+				chain, fresh = cmp, q.grab()
+			}
+			cmp, rest = q.scheduleList(chain, fresh, room)
+		}
+		chained = false
+
+		for cmp != locked {
+			other := nodeptrToNode[T](cmp)
+			if q.schedule == nil && (count == limit || (!deadline.IsZero() && !time.Now().Before(deadline))) {
+				rest = other
+				goto finish
+			}
+			if !q.claim(other) {
+				// Withdrawn by TryDo.
+				cmp = other.next
+				q.release(other)
+				continue
+			}
+
+			if last == nil {
+				first = other
+			} else if last.next != cmp {
+				// Link separately grabbed lists together.
+				atomicStoreNodeptr(&last.next, cmp)
+			}
+			last = other
+			cmp = other.next
+
+			q.batcher.Do(other.argument)
+			count++
+			inline += q.doInline()
+		}
+		if rest != nil {
 			break
 		}
+		cmp = q.grab()
 	}
 
-	// No more operations to combine, return.
-	if cmp == locked {
-		q.batcher.Finish()
+finish:
+	q.stats.record(count+inline, rest != nil)
+	// Linked operations, including our own when it was handed off.
+	processed := count - 1
+	if handoff {
+		processed++
+	}
+	q.pending.Add(-processed)
+	q.finishing()
+	q.batcher.Finish()
+	q.leave()
 
-		q.lock.Lock()
-		q.cond.Broadcast()
-		q.lock.Unlock()
-		return
+	if tuner != nil {
+		tuner.observeBatch(start, count+inline)
 	}
 
-combine:
-	// Execute the list of operations.
-	for cmp != locked {
-		other := nodeptrToNode[T](cmp)
-		if count == q.limit {
-			atomicStoreNodeptr(&other.next, other.next|handoffTag)
+	// Mark completion.
+	for n := first; n != nil; {
+		next := n.next
+		done := n == last
+		atomicStoreNodeptr(&n.next, 0)
+		if done {
+			break
+		}
+		n = nodeptrToNode[T](next)
+	}
+
+	if watch != nil {
+		watch.end()
+	}
 
-			q.batcher.Finish()
+	if own != nil {
+		// Run keeps the combiner role.
+		q.broadcast()
+		if rest == nil {
+			return locked
+		}
+		return rest.ref()
+	}
+	if r := q.runner.Load(); r != nil {
+		list := locked
+		if rest != nil {
+			list = rest.ref()
+		}
+		if r.handover(list) {
+			q.broadcast()
+			return 0
+		}
+	}
 
-			q.lock.Lock()
-			q.cond.Broadcast()
-			q.lock.Unlock()
-			return
+	for {
+		if rest == nil {
+			if atomicCompareAndSwapNodeptr(&q.head, locked, 0) {
+				// The queue is idle, Run may be waiting to acquire it.
+				if r := q.runner.Load(); r != nil {
+					r.signal()
+				}
+				break
+			}
+			// Operations were added during Finish.
+			list := q.grab()
+			if q.schedule != nil {
+				// Withdrawn operations may leave nothing to do.
+				list, _ = q.scheduleList(locked, list, -1)
+			}
+			if list != locked {
+				rest = nodeptrToNode[T](list)
+			}
 		}
-		cmp = other.next
+		if rest = q.claimRest(rest); rest != nil {
+			atomicStoreNodeptr(&rest.next, rest.next|handoffTag)
+			break
+		}
+	}
 
-		q.batcher.Do(other.argument)
-		count++
-		// Mark completion.
-		atomicStoreNodeptr(&other.next, 0)
+	if first == nil && rest == nil {
+		// Nobody is waiting for this batch.
+		return 0
 	}
+	q.broadcast()
+	return 0
+}
 
-	goto combinecheck
+// broadcast wakes up the parked waiters.
+func (q *Queue[T]) broadcast() {
+	q.lock.Lock()
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
+
+// grab detaches the list of waiting operations and leaves the queue locked.
+//
+// grab returns locked when there are no waiting operations.
+func (q *Queue[T]) grab() nodeptr {
+	for {
+		cmp := atomicLoadNodeptr(&q.head)
+		if cmp == locked {
+			return locked
+		}
+		if atomicCompareAndSwapNodeptr(&q.head, cmp, locked) {
+			return cmp
+		}
+	}
 }
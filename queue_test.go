@@ -0,0 +1,107 @@
+package combiner_test
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+type profileLabels struct {
+	profile bytes.Buffer
+}
+
+func (b *profileLabels) Start()     {}
+func (b *profileLabels) Do(arg int) {}
+func (b *profileLabels) Finish() {
+	b.profile.Reset()
+	_ = pprof.Lookup("goroutine").WriteTo(&b.profile, 1)
+}
+
+func TestProfileLabels(t *testing.T) {
+	var batcher profileLabels
+	q := combiner.New[int](&batcher, 0)
+	q.Name = "labeled"
+	q.ProfileLabels = true
+	q.Do(1)
+
+	profile := batcher.profile.String()
+	if !strings.Contains(profile, `"combiner":"labeled"`) || !strings.Contains(profile, `"role":"combiner"`) {
+		t.Fatalf("labels missing from goroutine profile:\n%s", profile)
+	}
+}
+
+type finishOrder struct {
+	batch    int64
+	finished atomic.Int64
+	applied  []atomic.Int64
+}
+
+func (b *finishOrder) Start()     { b.batch++ }
+func (b *finishOrder) Do(arg int) { b.applied[arg].Store(b.batch) }
+func (b *finishOrder) Finish()    { b.finished.Store(b.batch) }
+
+func TestReleaseAfterFinish(t *testing.T) {
+	const P, N = 8, 1000
+	batcher := &finishOrder{applied: make([]atomic.Int64, P*N)}
+	q := combiner.New[int](batcher, 3)
+
+	var wg sync.WaitGroup
+	wg.Add(P)
+	for p := 0; p < P; p++ {
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				arg := p*N + i
+				q.Do(arg)
+				if batch, finished := batcher.applied[arg].Load(), batcher.finished.Load(); finished < batch {
+					t.Errorf("released in batch %v before finishing, last finished %v", batch, finished)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+type slowDo struct {
+	size, largest int
+}
+
+func (b *slowDo) Start()     { b.size = 0 }
+func (b *slowDo) Do(arg int) { b.size++; time.Sleep(time.Millisecond) }
+func (b *slowDo) Finish() {
+	if b.size > b.largest {
+		b.largest = b.size
+	}
+}
+
+func TestMaxBatchDuration(t *testing.T) {
+	const P = 32
+	batcher := &slowDo{}
+	q := combiner.New[int](batcher, 0)
+	q.MaxBatchDuration = 3 * time.Millisecond
+
+	var wg sync.WaitGroup
+	wg.Add(P)
+	for p := 0; p < P; p++ {
+		go func() {
+			defer wg.Done()
+			q.Do(1)
+		}()
+	}
+	wg.Wait()
+
+	stats := q.Stats()
+	if stats.Elements != P {
+		t.Fatalf("processed %v elements", stats.Elements)
+	}
+	if batcher.largest >= P/2 || stats.Handoffs == 0 {
+		t.Fatalf("batches were not cut: largest %v, handoffs %v", batcher.largest, stats.Handoffs)
+	}
+}
@@ -0,0 +1,74 @@
+package combiner
+
+// Reducer merges the elements of a batch before applying them.
+//
+// Combine must be associative, the elements are combined in
+// the order they are processed. Reducer must not panic.
+type Reducer[T any] interface {
+	// Combine merges two elements into one.
+	Combine(a, b T) T
+	// Apply is called once per batch with the combination of its elements.
+	Apply(T)
+}
+
+// ReducingQueue is a combiner queue that folds each batch
+// into a single value using a Reducer.
+type ReducingQueue[T any] struct {
+	queue   Queue[T]
+	reducer reduceBatcher[T]
+}
+
+// reduceBatcher folds the batch and applies it in Finish.
+type reduceBatcher[T any] struct {
+	reducer Reducer[T]
+	acc     T
+	has     bool
+}
+
+func (b *reduceBatcher[T]) Start() { b.has = false }
+
+func (b *reduceBatcher[T]) Do(arg T) {
+	if !b.has {
+		b.acc, b.has = arg, true
+		return
+	}
+	b.acc = b.reducer.Combine(b.acc, arg)
+}
+
+func (b *reduceBatcher[T]) Finish() {
+	if b.has {
+		b.reducer.Apply(b.acc)
+	}
+	var zero T
+	b.acc, b.has = zero, false
+}
+
+// NewReducing creates a new reducing combiner queue.
+func NewReducing[T any](reducer Reducer[T], limit int) *ReducingQueue[T] {
+	q := &ReducingQueue[T]{}
+	q.Init(reducer, limit)
+	return q
+}
+
+// Init initializes a ReducingQueue combiner.
+// Note: NewReducing does this automatically.
+func (q *ReducingQueue[T]) Init(reducer Reducer[T], limit int) {
+	q.reducer.reducer = reducer
+	q.queue.Init(&q.reducer, limit)
+}
+
+// Do passes value to Reducer and waits until the combination
+// containing it has been applied.
+func (q *ReducingQueue[T]) Do(arg T) { q.queue.Do(arg) }
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *ReducingQueue[T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *ReducingQueue[T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *ReducingQueue[T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *ReducingQueue[T]) Control() Control { return &q.queue }
@@ -0,0 +1,41 @@
+package combiner_test
+
+import (
+	"sync"
+	"testing"
+
+	"loov.dev/combiner"
+)
+
+type sum struct {
+	total   int
+	applied int
+}
+
+func (s *sum) Combine(a, b int) int { return a + b }
+func (s *sum) Apply(v int)          { s.total += v; s.applied++ }
+
+func TestReducingQueue(t *testing.T) {
+	s := &sum{}
+	q := combiner.NewReducing[int](s, 16)
+
+	const procs, count = 8, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				q.Do(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.total != procs*count {
+		t.Fatalf("expected total %v, got %v", procs*count, s.total)
+	}
+	if stats := q.Stats(); uint64(s.applied) != stats.Batches {
+		t.Fatalf("expected one Apply per batch, got %v for %v batches", s.applied, stats.Batches)
+	}
+}
@@ -0,0 +1,109 @@
+package combiner
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Reentrancy controls how Do behaves when it is called from within
+// the Batcher of the same Queue, for example from Batcher.Do.
+//
+// Such calls enqueue the element behind the running batch and wait for it,
+// which deadlocks.
+type Reentrancy int
+
+const (
+	// ReentrancyIgnore does not check for reentrant calls.
+	ReentrancyIgnore Reentrancy = iota
+	// ReentrancyPanic panics on reentrant calls.
+	//
+	// The panic unwinds through the running batch, so the queue is
+	// unusable afterwards, even when the panic is recovered: the elements
+	// waiting for the batch are never released, and all later calls to
+	// Do and TryDo panic as well instead of waiting forever.
+	ReentrancyPanic
+	// ReentrancyInline adds the element of a reentrant call to the running
+	// batch. The element is passed to Batcher.Do after the current Start
+	// or Do has returned, and the reentrant Do returns without waiting.
+	//
+	// Reentrant calls from Batcher.Finish still panic, which leaves the
+	// queue unusable as with ReentrancyPanic.
+	ReentrancyInline
+)
+
+// reentrancy tracks the combiner goroutine for detecting reentrant calls.
+type reentrancy[T any] struct {
+	combiner  atomic.Int64
+	finishing bool
+	inline    []T
+	// broken is the panic message after a reentrant call
+	// has panicked through the running batch.
+	broken atomic.Pointer[string]
+}
+
+// reentrant handles Do being called by the goroutine running the batch.
+//
+// It returns true when arg was added to the running batch.
+func (q *Queue[T]) reentrant(arg T) bool {
+	if msg := q.reenter.broken.Load(); msg != nil {
+		panic(fmt.Sprintf("combiner %q: unusable after %s", q.Name, *msg))
+	}
+	if q.reenter.combiner.Load() != goid() {
+		return false
+	}
+	if q.Reentrancy == ReentrancyInline && !q.reenter.finishing {
+		q.reenter.inline = append(q.reenter.inline, arg)
+		return true
+	}
+
+	phase := "Start or Do"
+	if q.reenter.finishing {
+		phase = "Finish"
+	}
+	msg := "reentrant Do called from Batcher." + phase
+	q.reenter.broken.Store(&msg)
+	panic(fmt.Sprintf("combiner %q: %s", q.Name, msg))
+}
+
+// enter marks the current goroutine as the combiner.
+func (q *Queue[T]) enter() {
+	if q.Reentrancy == ReentrancyIgnore {
+		return
+	}
+	q.reenter.finishing = false
+	q.reenter.combiner.Store(goid())
+}
+
+// finishing marks that the combiner is about to call Batcher.Finish.
+func (q *Queue[T]) finishing() {
+	if q.Reentrancy == ReentrancyIgnore {
+		return
+	}
+	q.reenter.finishing = true
+}
+
+// leave marks that the current goroutine is not the combiner anymore.
+func (q *Queue[T]) leave() {
+	if q.Reentrancy == ReentrancyIgnore {
+		return
+	}
+	q.reenter.combiner.Store(0)
+}
+
+// doInline passes elements added by reentrant calls to the batcher.
+//
+// It returns the number of elements processed.
+func (q *Queue[T]) doInline() int64 {
+	var count int64
+	for len(q.reenter.inline) > 0 {
+		arg := q.reenter.inline[0]
+		var zero T
+		q.reenter.inline[0] = zero
+		q.reenter.inline = q.reenter.inline[1:]
+
+		q.batcher.Do(arg)
+		count++
+	}
+	q.reenter.inline = q.reenter.inline[:0]
+	return count
+}
@@ -0,0 +1,93 @@
+package combiner_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+type recursive struct {
+	queue    *combiner.Queue[int]
+	batches  int
+	applied  []int
+	inFinish bool
+}
+
+func (b *recursive) Start() { b.batches++ }
+func (b *recursive) Do(arg int) {
+	b.applied = append(b.applied, arg)
+	if arg > 0 {
+		b.queue.Do(arg - 1)
+	}
+}
+func (b *recursive) Finish() {
+	if b.inFinish {
+		b.queue.Do(0)
+	}
+}
+
+func TestReentrancyPanic(t *testing.T) {
+	b := &recursive{}
+	b.queue = combiner.New[int](b, 0)
+	b.queue.Name = "nested"
+	b.queue.Reentrancy = combiner.ReentrancyPanic
+
+	do := func(arg int) (msg string) {
+		defer func() { msg, _ = recover().(string) }()
+		b.queue.Do(arg)
+		return ""
+	}
+
+	if msg := do(1); !strings.Contains(msg, `combiner "nested": reentrant Do`) {
+		t.Fatalf("unexpected panic %q", msg)
+	}
+
+	// The batch did not finish, so the queue is still held by it,
+	// later calls must panic instead of waiting forever.
+	done := make(chan string)
+	go func() { done <- do(0) }()
+	select {
+	case msg := <-done:
+		if !strings.Contains(msg, `combiner "nested": unusable after reentrant Do`) {
+			t.Fatalf("unexpected panic %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do after a reentrancy panic did not return")
+	}
+	if stats := b.queue.Stats(); stats.Batches != 0 {
+		t.Fatalf("expected the batch to be unfinished, got %+v", stats)
+	}
+}
+
+func TestReentrancyInline(t *testing.T) {
+	b := &recursive{}
+	b.queue = combiner.New[int](b, 0)
+	b.queue.Reentrancy = combiner.ReentrancyInline
+
+	b.queue.Do(3)
+	b.queue.Do(1)
+
+	if b.batches != 2 || len(b.applied) != 6 {
+		t.Fatalf("got %v batches applying %v", b.batches, b.applied)
+	}
+	if stats := b.queue.Stats(); stats.Elements != 6 {
+		t.Fatalf("got %v elements", stats.Elements)
+	}
+}
+
+func TestReentrancyInlineFinish(t *testing.T) {
+	b := &recursive{inFinish: true}
+	b.queue = combiner.New[int](b, 0)
+	b.queue.Reentrancy = combiner.ReentrancyInline
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "Batcher.Finish") {
+			t.Fatalf("unexpected panic %q", msg)
+		}
+	}()
+	b.queue.Do(0)
+	t.Fatal("expected panic")
+}
@@ -0,0 +1,122 @@
+package combiner
+
+// ResultBatcher is the operation combining implementation
+// that returns a result for each element.
+//
+// ResultBatcher must not panic.
+type ResultBatcher[T, R any] interface {
+	// Start is called on a start of a new batch.
+	Start()
+	// Do is called for each batch element and returns its result.
+	Do(T) (R, error)
+	// Finish is called after completing a batch.
+	Finish()
+}
+
+// ResultQueue is a combiner queue that returns the result
+// of each element to its caller.
+type ResultQueue[T, R any] struct {
+	queue   Queue[*call[T, R]]
+	batcher resultBatcher[T, R]
+}
+
+// call is an element together with its result.
+type call[T, R any] struct {
+	arg    T
+	result R
+	err    error
+}
+
+// coalescer finds calls that duplicate an earlier call in the same batch.
+type coalescer[T, R any] interface {
+	// reset is called after completing a batch.
+	reset()
+	// duplicate returns the earlier call with the same key as c,
+	// otherwise it remembers c and returns nil.
+	duplicate(c *call[T, R]) *call[T, R]
+}
+
+// resultBatcher passes calls to the underlying ResultBatcher.
+type resultBatcher[T, R any] struct {
+	batcher  ResultBatcher[T, R]
+	coalesce coalescer[T, R]
+
+	// eliminate, when set, sees the whole batch before it is applied.
+	eliminate   Eliminator[T, R]
+	elimination Elimination[T, R]
+}
+
+func (b *resultBatcher[T, R]) Start() {
+	if b.eliminate != nil {
+		b.elimination.reset()
+		return
+	}
+	b.batcher.Start()
+}
+
+func (b *resultBatcher[T, R]) Do(c *call[T, R]) {
+	if b.eliminate != nil {
+		b.elimination.add(c)
+		return
+	}
+	b.apply(c)
+}
+
+func (b *resultBatcher[T, R]) Finish() {
+	if b.eliminate != nil {
+		b.finishEliminated()
+	} else {
+		b.batcher.Finish()
+	}
+	if b.coalesce != nil {
+		b.coalesce.reset()
+	}
+}
+
+// apply passes c to the ResultBatcher, unless it duplicates an earlier call.
+func (b *resultBatcher[T, R]) apply(c *call[T, R]) {
+	if b.coalesce != nil {
+		if leader := b.coalesce.duplicate(c); leader != nil {
+			c.result, c.err = leader.result, leader.err
+			return
+		}
+	}
+	c.result, c.err = b.batcher.Do(c.arg)
+}
+
+// NewResult creates a new combiner queue for a ResultBatcher.
+func NewResult[T, R any](batcher ResultBatcher[T, R], limit int) *ResultQueue[T, R] {
+	q := &ResultQueue[T, R]{}
+	q.Init(batcher, limit)
+	return q
+}
+
+// Init initializes a ResultQueue combiner.
+// Note: NewResult does this automatically.
+//
+// When batcher implements Eliminator, it is used for each batch.
+func (q *ResultQueue[T, R]) Init(batcher ResultBatcher[T, R], limit int) {
+	q.batcher.batcher = batcher
+	q.batcher.eliminate, _ = batcher.(Eliminator[T, R])
+	q.queue.Init(&q.batcher, limit)
+}
+
+// Do passes value to ResultBatcher, waits for completion
+// and returns the result of the value.
+func (q *ResultQueue[T, R]) Do(arg T) (R, error) {
+	c := &call[T, R]{arg: arg}
+	q.queue.Do(c)
+	return c.result, c.err
+}
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *ResultQueue[T, R]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *ResultQueue[T, R]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *ResultQueue[T, R]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *ResultQueue[T, R]) Control() Control { return &q.queue }
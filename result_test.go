@@ -0,0 +1,107 @@
+package combiner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+// lookup returns the length of the key, or an error for an empty key.
+type lookup struct {
+	release chan struct{}
+	calls   []string
+}
+
+func (b *lookup) Start() {}
+
+func (b *lookup) Do(key string) (int, error) {
+	b.calls = append(b.calls, key)
+	if key == "" {
+		return 0, errors.New("empty key")
+	}
+	return len(key), nil
+}
+
+func (b *lookup) Finish() {
+	if b.release != nil {
+		<-b.release
+	}
+}
+
+func TestResultQueue(t *testing.T) {
+	q := NewResult[string, int](&lookup{}, 0)
+	if n, err := q.Do("abc"); n != 3 || err != nil {
+		t.Fatalf("got %v, %v", n, err)
+	}
+	if _, err := q.Do(""); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestResultQueueOffload(t *testing.T) {
+	q := NewResult[string, int](&lookup{}, 4)
+
+	ran := make(chan struct{})
+	go func() {
+		q.Control().Run()
+		close(ran)
+	}()
+
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			key := strings.Repeat("x", p+1)
+			for i := 0; i < 100; i++ {
+				if n, err := q.Do(key); n != len(key) || err != nil {
+					t.Errorf("got %v, %v", n, err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	q.Control().Close()
+	<-ran
+
+	if stats := q.Stats(); stats.Elements != 800 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	batcher := &lookup{release: make(chan struct{})}
+	q := NewCoalescing[string, string, int](batcher, 0, func(key string) string { return key })
+
+	keys := []string{"block", "a", "bb", "a", "", "bb", "a", ""}
+	results := make([]string, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			n, err := q.Do(key)
+			results[i] = fmt.Sprint(n, err)
+		}(i, key)
+		if i == 0 {
+			testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+		}
+	}
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == uint64(len(keys)-1) })
+	close(batcher.release)
+	wg.Wait()
+
+	if len(batcher.calls) != 4 {
+		t.Fatalf("expected 4 distinct calls, got %q", batcher.calls)
+	}
+	expected := []string{"5 <nil>", "1 <nil>", "2 <nil>", "1 <nil>", "0 empty key", "2 <nil>", "1 <nil>", "0 empty key"}
+	if fmt.Sprint(results) != fmt.Sprint(expected) {
+		t.Fatalf("got %q", results)
+	}
+}
@@ -0,0 +1,65 @@
+package combiner
+
+import "sync/atomic"
+
+// scheduleList reorders operations using q.schedule.
+//
+// chain is a list of operations that is already in order and fresh
+// is a list of newly added operations, which are in reverse order.
+// Either of them may be empty.
+//
+// The operations are passed to q.schedule in arrival order together with
+// the room left in the batch, -1 meaning no limit. q.schedule reorders
+// them and returns how many of them to process in the current batch.
+//
+// scheduleList returns the list of operations to process and the first
+// operation that did not fit, or nil when all of them fit.
+func (q *Queue[T]) scheduleList(chain, fresh nodeptr, room int) (nodeptr, *node[T]) {
+	batch := q.batch[:0]
+	for chain != locked {
+		n := nodeptrToNode[T](chain)
+		chain = n.next
+		batch = q.appendPending(batch, n)
+	}
+	ordered := len(batch)
+	for fresh != locked {
+		n := nodeptrToNode[T](fresh)
+		fresh = n.next
+		batch = q.appendPending(batch, n)
+	}
+	for i, k := ordered, len(batch)-1; i < k; i, k = i+1, k-1 {
+		batch[i], batch[k] = batch[k], batch[i]
+	}
+
+	take := q.schedule(batch, room)
+
+	list := linkNodes(batch[:take])
+	var rest *node[T]
+	if take < len(batch) {
+		linkNodes(batch[take:])
+		rest = batch[take]
+	}
+
+	clear(batch)
+	q.batch = batch[:0]
+	return list, rest
+}
+
+// appendPending appends n to batch, unless it has been withdrawn by TryDo.
+func (q *Queue[T]) appendPending(batch []*node[T], n *node[T]) []*node[T] {
+	if q.tries.Load() && atomic.LoadUint32(&n.state) == nodeWithdrawn {
+		q.release(n)
+		return batch
+	}
+	return append(batch, n)
+}
+
+// linkNodes links nodes into a list terminated by locked.
+func linkNodes[T any](nodes []*node[T]) nodeptr {
+	next := locked
+	for i := len(nodes) - 1; i >= 0; i-- {
+		atomicStoreNodeptr(&nodes[i].next, next)
+		next = nodes[i].ref()
+	}
+	return next
+}
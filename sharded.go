@@ -0,0 +1,171 @@
+package combiner
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooManyShards is returned when a new shard is needed, but all
+// MaxShards shards are in use.
+var ErrTooManyShards = errors.New("combiner: too many shards")
+
+// Sharded routes elements by key to independent queues, so that
+// elements with unrelated keys never wait for each other.
+//
+// Queues are created lazily for each key. When MaxShards is reached,
+// the least recently used idle shard is evicted to make room.
+// Evicted queues are closed, which stops their Run and watchdog,
+// so create may start them.
+type Sharded[K comparable, T any] struct {
+	// MaxShards is the maximum number of shards, zero means no limit.
+	MaxShards int
+	// IdleTimeout is the duration after which an unused shard is evicted.
+	// Idle shards are evicted when creating new shards, zero means
+	// shards are only evicted to stay within MaxShards.
+	IdleTimeout time.Duration
+
+	create func(key K) *Queue[T]
+
+	mu      sync.RWMutex
+	shards  map[K]*shard[T]
+	evicted Stats
+}
+
+// shard is a queue for a single key.
+type shard[T any] struct {
+	queue  *Queue[T]
+	active atomic.Int64
+	used   atomic.Int64 // unix nanoseconds
+}
+
+// NewSharded creates a sharded combiner, which uses create to
+// make the queue for each key.
+func NewSharded[K comparable, T any](create func(key K) *Queue[T]) *Sharded[K, T] {
+	return &Sharded[K, T]{
+		create: create,
+		shards: map[K]*shard[T]{},
+	}
+}
+
+// Do passes value to the queue of key and waits for completion.
+//
+// Do returns ErrTooManyShards when a new shard is needed, but
+// all shards are in use.
+func (s *Sharded[K, T]) Do(key K, arg T) error {
+	sh, err := s.acquire(key)
+	if err != nil {
+		return err
+	}
+	sh.queue.Do(arg)
+	s.release(sh)
+	return nil
+}
+
+// acquire finds or creates the shard for key and marks it active.
+func (s *Sharded[K, T]) acquire(key K) (*shard[T], error) {
+	s.mu.RLock()
+	sh, ok := s.shards[key]
+	if ok {
+		sh.active.Add(1)
+	}
+	s.mu.RUnlock()
+	if ok {
+		return sh, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh, ok = s.shards[key]
+	if !ok {
+		now := time.Now()
+		if s.IdleTimeout > 0 {
+			s.evictIdle(now.Add(-s.IdleTimeout))
+		}
+		if s.MaxShards > 0 && len(s.shards) >= s.MaxShards && !s.evictOldest() {
+			return nil, ErrTooManyShards
+		}
+
+		sh = &shard[T]{queue: s.create(key)}
+		sh.used.Store(now.UnixNano())
+		s.shards[key] = sh
+	}
+	sh.active.Add(1)
+	return sh, nil
+}
+
+// release marks the shard inactive.
+func (s *Sharded[K, T]) release(sh *shard[T]) {
+	sh.used.Store(time.Now().UnixNano())
+	sh.active.Add(-1)
+}
+
+// EvictIdle removes shards that have not been used for the duration.
+// It returns the number of evicted shards.
+func (s *Sharded[K, T]) EvictIdle(idle time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictIdle(time.Now().Add(-idle))
+}
+
+// evictIdle removes inactive shards last used before the deadline.
+func (s *Sharded[K, T]) evictIdle(deadline time.Time) int {
+	evicted := 0
+	for key, sh := range s.shards {
+		if sh.active.Load() == 0 && sh.used.Load() <= deadline.UnixNano() {
+			s.evict(key, sh)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// evictOldest removes the least recently used inactive shard.
+func (s *Sharded[K, T]) evictOldest() bool {
+	var oldestKey K
+	var oldest *shard[T]
+	for key, sh := range s.shards {
+		if sh.active.Load() != 0 {
+			continue
+		}
+		if oldest == nil || sh.used.Load() < oldest.used.Load() {
+			oldestKey, oldest = key, sh
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	s.evict(oldestKey, oldest)
+	return true
+}
+
+// evict removes the shard and keeps its statistics.
+func (s *Sharded[K, T]) evict(key K, sh *shard[T]) {
+	stats := sh.queue.Stats()
+	stats.Pending = 0
+	s.evicted.add(stats)
+	delete(s.shards, key)
+	sh.queue.Close()
+}
+
+// Len returns the number of shards.
+func (s *Sharded[K, T]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.shards)
+}
+
+// Stats returns the combined statistics of all shards,
+// including the ones that have been evicted.
+func (s *Sharded[K, T]) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := s.evicted
+	for _, sh := range s.shards {
+		total.add(sh.queue.Stats())
+	}
+	return total
+}
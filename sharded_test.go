@@ -0,0 +1,88 @@
+package combiner_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/internal/testsuite"
+)
+
+func TestSharded(t *testing.T) {
+	created := map[string]*blockingFinish{}
+	s := combiner.NewSharded(func(key string) *combiner.Queue[int] {
+		b := &blockingFinish{release: make(chan struct{})}
+		if !strings.HasPrefix(key, "blocked") {
+			close(b.release)
+		}
+		created[key] = b
+		return combiner.New[int](b, 0)
+	})
+	s.MaxShards = 2
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if err := s.Do(key, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Len() != 2 || len(created) != 3 {
+		t.Fatalf("expected eviction, got %v shards, created %v", s.Len(), len(created))
+	}
+	if stats := s.Stats(); stats.Elements != 4 || stats.Batches != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Do("blocked1", 1) }()
+	go func() { done <- s.Do("blocked2", 1) }()
+	testsuite.WaitUntil(t, func() bool { return s.Stats().Batches == 6 })
+
+	if err := s.Do("d", 1); !errors.Is(err, combiner.ErrTooManyShards) {
+		t.Fatalf("expected too many shards, got %v", err)
+	}
+
+	close(created["blocked1"].release)
+	close(created["blocked2"].release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if evicted := s.EvictIdle(0); evicted != 2 || s.Len() != 0 {
+		t.Fatalf("evicted %v, left %v", evicted, s.Len())
+	}
+	if stats := s.Stats(); stats.Elements != 6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestShardedEvictCloses(t *testing.T) {
+	running := make(chan struct{}, 1)
+	stopped := make(chan struct{}, 1)
+	s := combiner.NewSharded(func(key string) *combiner.Queue[int] {
+		q := combiner.New[int](&Nop{}, 0)
+		q.StartWatchdog(combiner.Watchdog{Threshold: time.Second, Report: func(combiner.Stall) {}})
+		go func() {
+			running <- struct{}{}
+			q.Run()
+			stopped <- struct{}{}
+		}()
+		return q
+	})
+
+	if err := s.Do("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	<-running
+	if n := s.EvictIdle(0); n != 1 {
+		t.Fatalf("expected 1 evicted shard, got %v", n)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run of the evicted queue did not stop")
+	}
+}
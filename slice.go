@@ -0,0 +1,69 @@
+package combiner
+
+// SliceBatcher is the operation combining implementation
+// that receives the whole batch at once.
+//
+// SliceBatcher must not panic.
+type SliceBatcher[T any] interface {
+	// Batch is called with the elements of a batch.
+	// The slice is only valid during the call.
+	Batch(batch []T)
+}
+
+// SliceQueue is a combiner queue that collects each batch
+// into a slice before passing it to SliceBatcher.
+type SliceQueue[T any] struct {
+	queue   Queue[T]
+	batcher sliceBatcher[T]
+}
+
+// sliceBatcher collects the batch and passes it to SliceBatcher.
+type sliceBatcher[T any] struct {
+	batcher SliceBatcher[T]
+	order   func(batch []T)
+	batch   []T
+}
+
+func (b *sliceBatcher[T]) Start()   { b.batch = b.batch[:0] }
+func (b *sliceBatcher[T]) Do(arg T) { b.batch = append(b.batch, arg) }
+
+func (b *sliceBatcher[T]) Finish() {
+	if b.order != nil {
+		b.order(b.batch)
+	}
+	b.batcher.Batch(b.batch)
+	clear(b.batch)
+}
+
+// NewSlice creates a new combiner queue for a SliceBatcher.
+//
+// order, when not nil, sorts each batch before it is passed to
+// SliceBatcher; see ByLess and ByKey.
+func NewSlice[T any](batcher SliceBatcher[T], limit int, order func(batch []T)) *SliceQueue[T] {
+	q := &SliceQueue[T]{}
+	q.Init(batcher, limit, order)
+	return q
+}
+
+// Init initializes a SliceQueue combiner.
+// Note: NewSlice does this automatically.
+func (q *SliceQueue[T]) Init(batcher SliceBatcher[T], limit int, order func(batch []T)) {
+	q.batcher.batcher = batcher
+	q.batcher.order = order
+	q.queue.Init(&q.batcher, limit)
+}
+
+// Do passes value to SliceBatcher and waits for completion.
+func (q *SliceQueue[T]) Do(arg T) { q.queue.Do(arg) }
+
+// Limit returns the maximum number of elements in a single batch.
+func (q *SliceQueue[T]) Limit() int { return q.queue.Limit() }
+
+// SetLimit changes the maximum number of elements in a single batch.
+func (q *SliceQueue[T]) SetLimit(limit int) { q.queue.SetLimit(limit) }
+
+// Stats returns a snapshot of the queue statistics.
+func (q *SliceQueue[T]) Stats() Stats { return q.queue.Stats() }
+
+// Control returns the underlying queue.
+func (q *SliceQueue[T]) Control() Control { return &q.queue }
@@ -0,0 +1,119 @@
+package combiner
+
+import "sort"
+
+// NewSorted creates a new combiner queue that passes the elements
+// of each batch to Batcher in the order given by order.
+//
+// order sorts a batch, see ByLess and ByKey.
+func NewSorted[T any](batcher Batcher[T], limit int, order func(batch []T)) *SliceQueue[T] {
+	return NewSlice[T](batchSlice[T]{batcher}, limit, order)
+}
+
+// batchSlice passes a slice to Batcher element by element.
+type batchSlice[T any] struct {
+	batcher Batcher[T]
+}
+
+func (b batchSlice[T]) Batch(batch []T) {
+	b.batcher.Start()
+	for _, arg := range batch {
+		b.batcher.Do(arg)
+	}
+	b.batcher.Finish()
+}
+
+// ByLess returns an order that stable sorts a batch using less.
+func ByLess[T any](less func(a, b T) bool) func(batch []T) {
+	return func(batch []T) {
+		sort.SliceStable(batch, func(i, k int) bool { return less(batch[i], batch[k]) })
+	}
+}
+
+// ByKey returns an order that stable sorts a batch by an integer key
+// using radix sort.
+//
+// The returned order reuses its buffers, so it must only be used
+// by a single queue.
+func ByKey[T any](key func(T) uint64) func(batch []T) {
+	r := &radixSorter[T]{key: key}
+	return r.sort
+}
+
+// radixSorter implements least significant digit radix sort.
+type radixSorter[T any] struct {
+	key func(T) uint64
+
+	keys, keysTmp []uint64
+	tmp           []T
+}
+
+// radixInsertion is the batch size below which insertion sort is used.
+const radixInsertion = 32
+
+func (r *radixSorter[T]) sort(batch []T) {
+	n := len(batch)
+	if n < 2 {
+		return
+	}
+
+	r.keys = resize(r.keys, n)
+	for i, v := range batch {
+		r.keys[i] = r.key(v)
+	}
+
+	if n <= radixInsertion {
+		keys := r.keys
+		for i := 1; i < n; i++ {
+			for k := i; k > 0 && keys[k] < keys[k-1]; k-- {
+				keys[k], keys[k-1] = keys[k-1], keys[k]
+				batch[k], batch[k-1] = batch[k-1], batch[k]
+			}
+		}
+		return
+	}
+
+	r.keysTmp = resize(r.keysTmp, n)
+	r.tmp = resize(r.tmp, n)
+
+	src, dst := batch, r.tmp
+	srcKeys, dstKeys := r.keys, r.keysTmp
+	for shift := 0; shift < 64; shift += 8 {
+		var offsets [256]int
+		for _, key := range srcKeys {
+			offsets[byte(key>>shift)]++
+		}
+		if offsets[byte(srcKeys[0]>>shift)] == n {
+			// All keys have the same digit.
+			continue
+		}
+
+		total := 0
+		for digit, count := range offsets {
+			offsets[digit] = total
+			total += count
+		}
+		for i, key := range srcKeys {
+			digit := byte(key >> shift)
+			dst[offsets[digit]] = src[i]
+			dstKeys[offsets[digit]] = key
+			offsets[digit]++
+		}
+
+		src, dst = dst, src
+		srcKeys, dstKeys = dstKeys, srcKeys
+	}
+
+	if &src[0] != &batch[0] {
+		copy(batch, src)
+	}
+	clear(r.tmp)
+}
+
+// resize returns a slice of length n, reusing the capacity of s.
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
@@ -0,0 +1,103 @@
+package combiner_test
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner"
+)
+
+type keyed struct {
+	key   uint64
+	index int
+}
+
+func TestByKey(t *testing.T) {
+	order := combiner.ByKey(func(v keyed) uint64 { return v.key })
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 10, 32, 33, 100, 1000} {
+		for _, spread := range []uint64{1, 16, 1 << 20, 1 << 63} {
+			batch := make([]keyed, n)
+			for i := range batch {
+				batch[i] = keyed{key: uint64(rng.Int63()) % spread, index: i}
+			}
+			if spread == 1<<63 && n > 0 {
+				batch[0].key = 1<<64 - 1
+			}
+
+			expected := append([]keyed{}, batch...)
+			sort.SliceStable(expected, func(i, k int) bool { return expected[i].key < expected[k].key })
+
+			order(batch)
+			for i := range batch {
+				if batch[i] != expected[i] {
+					t.Fatalf("n=%v spread=%v: mismatch at %v: got %v, expected %v", n, spread, i, batch[i], expected[i])
+				}
+			}
+		}
+	}
+}
+
+type sortedChecker struct {
+	t       *testing.T
+	last    int
+	started bool
+	count   int
+}
+
+func (b *sortedChecker) Start() { b.started = false }
+
+func (b *sortedChecker) Do(v int) {
+	if b.started && v < b.last {
+		b.t.Errorf("batch not sorted: %v after %v", v, b.last)
+	}
+	b.last, b.started = v, true
+	b.count++
+}
+
+func (b *sortedChecker) Finish() {}
+
+func (b *sortedChecker) Batch(batch []int) {
+	if !sort.IntsAreSorted(batch) {
+		b.t.Errorf("batch not sorted: %v", batch)
+	}
+	b.count += len(batch)
+}
+
+func TestSortedQueue(t *testing.T) {
+	byLess := combiner.ByLess(func(a, b int) bool { return a < b })
+	byKey := combiner.ByKey(func(v int) uint64 { return uint64(v) })
+
+	for _, test := range []struct {
+		name   string
+		create func(b *sortedChecker) func(int)
+	}{
+		{"Sorted", func(b *sortedChecker) func(int) { return combiner.NewSorted[int](b, 64, byKey).Do }},
+		{"Slice", func(b *sortedChecker) func(int) { return combiner.NewSlice[int](b, 64, byLess).Do }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			check := &sortedChecker{t: t}
+			do := test.create(check)
+
+			const procs, count = 8, 1000
+			var wg sync.WaitGroup
+			for p := 0; p < procs; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(p)))
+					for i := 0; i < count; i++ {
+						do(rng.Intn(1000))
+					}
+				}(p)
+			}
+			wg.Wait()
+
+			if check.count != procs*count {
+				t.Fatalf("expected %v elements, got %v", procs*count, check.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package combiner
+
+import "sync/atomic"
+
+// Stats contains statistics about a Queue.
+type Stats struct {
+	// Batches is the number of batches started.
+	Batches uint64
+	// Elements is the number of elements passed to Batcher.Do.
+	Elements uint64
+	// Handoffs is the number of batches that were cut at the limit and
+	// passed the remaining elements on to another combiner.
+	Handoffs uint64
+	// Overloaded is the number of elements rejected with ErrOverloaded.
+	Overloaded uint64
+	// Withdrawn is the number of elements withdrawn by TryDo.
+	Withdrawn uint64
+	// Uncontended is the number of elements processed by Hybrid
+	// without combining.
+	Uncontended uint64
+	// ModeSwitches is the number of times Hybrid switched between
+	// locking and combining.
+	ModeSwitches uint64
+	// Pending is the approximate number of unprocessed elements.
+	Pending uint64
+}
+
+// add adds the counters of other to s.
+func (s *Stats) add(other Stats) {
+	s.Batches += other.Batches
+	s.Elements += other.Elements
+	s.Handoffs += other.Handoffs
+	s.Overloaded += other.Overloaded
+	s.Withdrawn += other.Withdrawn
+	s.Uncontended += other.Uncontended
+	s.ModeSwitches += other.ModeSwitches
+	s.Pending += other.Pending
+}
+
+// queueStats contains the counters updated by the combiner.
+type queueStats struct {
+	batches  uint64
+	elements uint64
+	handoffs uint64
+
+	overloaded uint64
+	withdrawn  uint64
+}
+
+// record adds a finished batch to the counters.
+func (s *queueStats) record(count int64, handoff bool) {
+	atomic.AddUint64(&s.batches, 1)
+	atomic.AddUint64(&s.elements, uint64(count))
+	if handoff {
+		atomic.AddUint64(&s.handoffs, 1)
+	}
+}
+
+// Stats returns a snapshot of the queue statistics.
+//
+// The counters are read individually, so they may be slightly
+// inconsistent with each other while the queue is in use.
+func (q *Queue[T]) Stats() Stats {
+	pending := q.pending.Load()
+	if pending < 0 {
+		pending = 0
+	}
+	return Stats{
+		Batches:    atomic.LoadUint64(&q.stats.batches),
+		Elements:   atomic.LoadUint64(&q.stats.elements),
+		Handoffs:   atomic.LoadUint64(&q.stats.handoffs),
+		Overloaded: atomic.LoadUint64(&q.stats.overloaded),
+		Withdrawn:  atomic.LoadUint64(&q.stats.withdrawn),
+		Pending:    uint64(pending),
+	}
+}
@@ -0,0 +1,123 @@
+package combiner
+
+import "sync/atomic"
+
+// TryDo passes value to Batcher only when it can be processed
+// without parking.
+//
+// When the queue is idle, TryDo becomes the combiner. Otherwise it adds
+// the value to the queue and spins for a short while. When the value is
+// not picked up by then, TryDo withdraws it and returns false without
+// parking. A withdrawn value is skipped by the combiner.
+//
+// When a combiner has already taken the value into its batch, TryDo
+// waits for that batch to complete and returns true.
+//
+// TryDo returns false when the queue is overloaded.
+func (q *Queue[T]) TryDo(arg T) bool {
+	if q.Reentrancy != ReentrancyIgnore && q.reentrant(arg) {
+		return true
+	}
+	if q.overloaded() {
+		return false
+	}
+	if !q.tries.Load() {
+		// From now on combiners need to claim nodes before using them.
+		q.tries.Store(true)
+	}
+
+	my := q.link(arg)
+	if my == nil {
+		q.run(arg, locked, false, nil)
+		return true
+	}
+
+	return q.tryWait(my)
+}
+
+// tryWait waits for my to complete for a short while, otherwise
+// withdraws it.
+func (q *Queue[T]) tryWait(my *node[T]) bool {
+	done, handoff := q.spin(my)
+	if !done {
+		if q.withdraw(my) {
+			q.freeNode(my)
+			return false
+		}
+		if q.abandon(my) {
+			return false
+		}
+		// The combiner has taken the value into its batch.
+		handoff = q.wait(my)
+	}
+
+	if handoff {
+		q.run(my.argument, my.next, true, nil)
+	}
+	q.freeNode(my)
+	return true
+}
+
+// withdraw removes my from the list when it is still at the top.
+func (q *Queue[T]) withdraw(my *node[T]) bool {
+	if !atomicCompareAndSwapNodeptr(&q.head, my.ref(), atomicLoadNodeptr(&my.next)) {
+		return false
+	}
+	q.withdrawn()
+	return true
+}
+
+// abandon withdraws my, which is somewhere in the list,
+// by marking it for the combiner to skip and release.
+func (q *Queue[T]) abandon(my *node[T]) bool {
+	// Keep the node alive until the combiner releases it.
+	q.abandonLock.Lock()
+	if q.abandoned == nil {
+		q.abandoned = map[*node[T]]struct{}{}
+	}
+	q.abandoned[my] = struct{}{}
+	q.abandonLock.Unlock()
+
+	if !my.withdraw() {
+		q.abandonLock.Lock()
+		delete(q.abandoned, my)
+		q.abandonLock.Unlock()
+		return false
+	}
+	q.withdrawn()
+	return true
+}
+
+// withdrawn counts a withdrawn value.
+func (q *Queue[T]) withdrawn() {
+	q.pending.Add(-1)
+	atomic.AddUint64(&q.stats.withdrawn, 1)
+}
+
+// claim claims n for the combiner.
+// It returns false when n has been withdrawn and must be released.
+func (q *Queue[T]) claim(n *node[T]) bool {
+	return !q.tries.Load() || n.claim()
+}
+
+// release releases a withdrawn node after the combiner has skipped it.
+func (q *Queue[T]) release(n *node[T]) {
+	q.abandonLock.Lock()
+	delete(q.abandoned, n)
+	q.abandonLock.Unlock()
+	q.freeNode(n)
+}
+
+// claimRest claims the first node of the list starting at rest
+// that has not been withdrawn. It returns nil when there is none.
+func (q *Queue[T]) claimRest(rest *node[T]) *node[T] {
+	for rest != nil && !q.claim(rest) {
+		next := rest.next
+		q.release(rest)
+		rest = nil
+		if next != locked {
+			rest = nodeptrToNode[T](next)
+		}
+	}
+	return rest
+}
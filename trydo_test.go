@@ -0,0 +1,132 @@
+package combiner
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/internal/testsuite"
+)
+
+func TestTryDo(t *testing.T) {
+	batcher := &batchRecorder{gate: make(chan struct{})}
+	q := New[int](batcher, 0)
+
+	done := make(chan bool)
+	go func() { done <- q.TryDo(1) }()
+
+	// wait for the combiner to block in Finish
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+
+	if q.TryDo(2) {
+		t.Fatal("expected TryDo to fail while combiner is blocked")
+	}
+	if stats := q.Stats(); stats.Withdrawn != 1 || stats.Pending != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	close(batcher.gate)
+	if !<-done {
+		t.Fatal("expected TryDo to succeed on an idle queue")
+	}
+	if !q.TryDo(3) {
+		t.Fatal("expected TryDo to succeed on an idle queue")
+	}
+	if got := fmt.Sprint(batcher.batches); got != "[[1] [3]]" {
+		t.Fatalf("unexpected batches %v", got)
+	}
+}
+
+func TestTryDoWithdrawBelowTop(t *testing.T) {
+	batcher := &batchRecorder{gate: make(chan struct{})}
+	q := New[int](batcher, 0)
+
+	first := make(chan struct{})
+	go func() {
+		q.Do(1)
+		close(first)
+	}()
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Batches == 1 })
+
+	// Link the TryDo value manually, so that another value
+	// can be linked on top of it before it gives up.
+	q.tries.Store(true)
+	my := q.link(2)
+	if my == nil {
+		t.Fatal("expected the queue to be busy")
+	}
+
+	third := make(chan struct{})
+	go func() {
+		q.Do(3)
+		close(third)
+	}()
+	testsuite.WaitUntil(t, func() bool { return q.Stats().Pending == 2 })
+
+	if q.tryWait(my) {
+		t.Fatal("expected TryDo to fail while combiner is blocked")
+	}
+	if stats := q.Stats(); stats.Withdrawn != 1 || stats.Pending != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	close(batcher.gate)
+	<-first
+	<-third
+
+	if len(batcher.batches) != 2 ||
+		len(batcher.batches[0]) != 1 || batcher.batches[0][0] != 1 ||
+		len(batcher.batches[1]) != 1 || batcher.batches[1][0] != 3 {
+		t.Fatalf("unexpected batches %v", batcher.batches)
+	}
+
+	q.abandonLock.Lock()
+	abandoned := len(q.abandoned)
+	q.abandonLock.Unlock()
+	if abandoned != 0 {
+		t.Fatalf("%d withdrawn nodes were not released", abandoned)
+	}
+}
+
+type countBatcher struct{ count int }
+
+func (b *countBatcher) Start()  {}
+func (b *countBatcher) Do(int)  { b.count++ }
+func (b *countBatcher) Finish() {}
+
+func TestTryDoConcurrent(t *testing.T) {
+	batcher := &countBatcher{}
+	q := New[int](batcher, 4)
+
+	const workers, calls = 8, 1000
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			succeeded := 0
+			for i := 0; i < calls; i++ {
+				if w%2 == 0 {
+					q.Do(i)
+					succeeded++
+				} else if q.TryDo(i) {
+					succeeded++
+				}
+			}
+			mu.Lock()
+			total += succeeded
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+
+	if batcher.count != total {
+		t.Fatalf("applied %d values, expected %d", batcher.count, total)
+	}
+	if stats := q.Stats(); stats.Withdrawn != uint64(workers*calls-total) {
+		t.Fatalf("withdrew %d values, expected %d", stats.Withdrawn, workers*calls-total)
+	}
+}
@@ -0,0 +1,113 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrCorrupt is returned when a record before the end of the log is damaged.
+var ErrCorrupt = errors.New("wal: corrupt log")
+
+// Reader replays the records of a log.
+//
+// Reader stops at the first incomplete or damaged record of the last
+// segment, which is what a crash during an append leaves behind.
+type Reader struct {
+	dir      string
+	from     uint64
+	segments []uint64
+	index    int
+
+	file *os.File
+	rd   *bufio.Reader
+	lsn  uint64
+	buf  []byte
+}
+
+// NewReader creates a reader for the log in dir, starting at
+// the record from. When the records before from have been truncated,
+// the reader starts at the first available record.
+func NewReader(dir string, from uint64) (*Reader, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{dir: dir, from: from, segments: segments}
+	for r.index+1 < len(segments) && segments[r.index+1] <= from {
+		r.index++
+	}
+	return r, nil
+}
+
+// Next returns the next record. The data is only valid until the next call.
+//
+// Next returns io.EOF after the last complete record.
+func (r *Reader) Next() (lsn uint64, data []byte, err error) {
+	for {
+		if r.file == nil {
+			if err := r.open(); err != nil {
+				return 0, nil, err
+			}
+		}
+
+		data, err := readRecord(r.rd, r.buf)
+		if err == io.EOF || err == errTorn {
+			if r.index == len(r.segments)-1 {
+				// A torn tail ends the log.
+				return 0, nil, io.EOF
+			}
+			if err == errTorn || r.segments[r.index+1] != r.lsn {
+				return 0, nil, fmt.Errorf("%w: %s ends at record %d", ErrCorrupt, r.file.Name(), r.lsn)
+			}
+
+			if err := r.file.Close(); err != nil {
+				return 0, nil, err
+			}
+			r.file, r.rd = nil, nil
+			r.index++
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		r.buf = data
+		lsn := r.lsn
+		r.lsn++
+		if lsn < r.from {
+			continue
+		}
+		return lsn, data, nil
+	}
+}
+
+// open opens the current segment.
+func (r *Reader) open() error {
+	if r.index >= len(r.segments) {
+		return io.EOF
+	}
+
+	start := r.segments[r.index]
+	f, err := os.Open(segmentPath(r.dir, start))
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.rd = bufio.NewReader(f)
+	r.lsn = start
+	return nil
+}
+
+// Close closes the reader.
+func (r *Reader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.rd = nil, nil
+	return err
+}
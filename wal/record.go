@@ -0,0 +1,72 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Each record is framed as:
+//
+//	length uint32 little endian
+//	crc    uint32 little endian, CRC32C of length and data
+//	data   [length]byte
+const headerSize = 8
+
+// MaxRecordSize is the largest record that can be appended.
+const MaxRecordSize = 1 << 30
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTorn is returned when a record is incomplete or fails the checksum.
+var errTorn = errors.New("wal: torn record")
+
+// appendRecord appends the framed data to buf.
+func appendRecord(buf, data []byte) []byte {
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(data)))
+	crc := crc32.Update(0, castagnoli, header[0:4])
+	crc = crc32.Update(crc, castagnoli, data)
+	binary.LittleEndian.PutUint32(header[4:8], crc)
+
+	buf = append(buf, header[:]...)
+	return append(buf, data...)
+}
+
+// readRecord reads a single record from rd, reusing buf.
+//
+// readRecord returns io.EOF when rd is at the end and errTorn when
+// the record is incomplete or corrupted.
+func readRecord(rd *bufio.Reader, buf []byte) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(rd, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if length > MaxRecordSize {
+		return nil, errTorn
+	}
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	data := buf[:length]
+	if _, err := io.ReadFull(rd, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, err
+	}
+
+	crc := crc32.Update(0, castagnoli, header[0:4])
+	crc = crc32.Update(crc, castagnoli, data)
+	if crc != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, errTorn
+	}
+	return data, nil
+}
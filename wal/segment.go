@@ -0,0 +1,84 @@
+package wal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentExt is the extension of segment files.
+const segmentExt = ".wal"
+
+// segmentName returns the file name of the segment starting at lsn.
+func segmentName(lsn uint64) string {
+	return fmt.Sprintf("%020d%s", lsn, segmentExt)
+}
+
+// listSegments returns the first LSNs of the segments in dir in order.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		lsn, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, lsn)
+	}
+	sort.Slice(segments, func(i, k int) bool { return segments[i] < segments[k] })
+	return segments, nil
+}
+
+// scanSegment returns the number of valid records in the segment
+// and the size they occupy. Anything after them is a torn tail.
+func scanSegment(f *os.File) (count uint64, size int64, err error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	rd := bufio.NewReader(f)
+	var buf []byte
+	for {
+		data, err := readRecord(rd, buf)
+		if err == io.EOF || err == errTorn {
+			return count, size, nil
+		}
+		if err != nil {
+			return count, size, err
+		}
+		buf = data
+		count++
+		size += headerSize + int64(len(data))
+	}
+}
+
+// syncDir makes changes to the directory entries durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// segmentPath returns the path of the segment starting at lsn.
+func segmentPath(dir string, lsn uint64) string {
+	return filepath.Join(dir, segmentName(lsn))
+}
@@ -0,0 +1,281 @@
+// Package wal implements a write-ahead log with group commit.
+//
+// The log is a directory of segment files, each named by the log sequence
+// number (LSN) of its first record. Records are length-prefixed and
+// protected by a CRC32C checksum, so a torn tail left by a crash is
+// detected and discarded when the log is opened.
+//
+// Concurrent appends are combined into a single write and sync per batch.
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"loov.dev/combiner"
+	"loov.dev/combiner/fileappend"
+	"loov.dev/combiner/internal/syncfile"
+)
+
+// ErrClosed is returned when using a closed Log.
+var ErrClosed = errors.New("wal: log closed")
+
+// ErrTooLarge is returned when appending a record larger than MaxRecordSize.
+var ErrTooLarge = errors.New("wal: record too large")
+
+// DefaultSegmentSize is the segment size used when Options.SegmentSize is zero.
+const DefaultSegmentSize = 64 << 20
+
+// Options configures a Log.
+type Options struct {
+	// SegmentSize is the size after which a new segment is started,
+	// DefaultSegmentSize when zero.
+	SegmentSize int64
+	// Limit is the maximum number of records in a single batch.
+	// Zero means there is no limit.
+	Limit int
+	// Sync makes the written records durable, fileappend.DataSync when nil.
+	Sync func(f *os.File) error
+}
+
+// Log is a write-ahead log.
+//
+// Append, Truncate and Close can be called concurrently.
+type Log struct {
+	dir   string
+	opts  Options
+	queue combiner.Queue[*entry]
+
+	// The following fields are only used by the combiner.
+
+	// segments are the first LSNs of the segments, the last is active.
+	segments []uint64
+	active   syncfile.File
+	// next is the LSN of the next record.
+	next uint64
+	// err is a failure that leaves the log in an unknown state.
+	err     error
+	closed  bool
+	pending []*entry
+	buf     []byte
+}
+
+// entryKind is the kind of operation passed through the queue.
+type entryKind byte
+
+const (
+	appendEntry entryKind = iota
+	truncateEntry
+	closeEntry
+)
+
+// entry is a single Append, Truncate or Close call.
+type entry struct {
+	kind entryKind
+	data []byte
+	lsn  uint64
+	err  error
+}
+
+// Open opens the log in dir, creating it when needed.
+//
+// A torn tail of the last segment is removed, so that new records
+// follow the last complete one.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.Sync == nil {
+		opts.Sync = fileappend.DataSync
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, opts: opts}
+	if len(segments) == 0 {
+		l.next = 1
+		if err := l.create(1); err != nil {
+			return nil, err
+		}
+	} else if err := l.recover(segments); err != nil {
+		return nil, err
+	}
+
+	l.queue.Init((*logBatcher)(l), opts.Limit)
+	return l, nil
+}
+
+// recover opens the last segment and removes its torn tail.
+func (l *Log) recover(segments []uint64) error {
+	start := segments[len(segments)-1]
+	f, err := os.OpenFile(segmentPath(l.dir, start), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	count, size, err := scanSegment(f)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		err = l.opts.Sync(f)
+	}
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("wal: recovering %s: %w", f.Name(), err)
+	}
+
+	l.segments = segments
+	l.active = syncfile.File{File: f, Sync: l.opts.Sync, Size: size}
+	l.next = start + count
+	return nil
+}
+
+// create starts a new segment at lsn.
+func (l *Log) create(lsn uint64) error {
+	f, err := os.OpenFile(segmentPath(l.dir, lsn), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	l.segments = append(l.segments, lsn)
+	l.active = syncfile.File{File: f, Sync: l.opts.Sync}
+	return nil
+}
+
+// Append writes data as a new record and waits until it has been synced.
+// It returns the LSN of the record.
+func (l *Log) Append(data []byte) (lsn uint64, err error) {
+	if len(data) > MaxRecordSize {
+		return 0, ErrTooLarge
+	}
+	e := &entry{kind: appendEntry, data: data}
+	l.queue.Do(e)
+	return e.lsn, e.err
+}
+
+// Truncate removes the segments that only contain records before lsn,
+// typically after a checkpoint has made them unnecessary.
+//
+// Records before lsn that share a segment with later records are kept.
+func (l *Log) Truncate(lsn uint64) error {
+	e := &entry{kind: truncateEntry, lsn: lsn}
+	l.queue.Do(e)
+	return e.err
+}
+
+// Close syncs and closes the log.
+func (l *Log) Close() error {
+	e := &entry{kind: closeEntry}
+	l.queue.Do(e)
+	return e.err
+}
+
+// Stats returns a snapshot of the queue statistics.
+func (l *Log) Stats() combiner.Stats { return l.queue.Stats() }
+
+// logBatcher implements combiner.Batcher for Log.
+type logBatcher Log
+
+func (l *logBatcher) Start() {}
+
+func (l *logBatcher) Do(e *entry) {
+	switch {
+	case l.closed:
+		e.err = ErrClosed
+	case e.kind == closeEntry:
+		l.flush()
+		e.err = l.err
+		if l.active.File != nil {
+			e.err = errors.Join(e.err, l.active.File.Close())
+			l.active.File = nil
+		}
+		l.closed = true
+	case l.err != nil:
+		e.err = l.err
+	case e.kind == appendEntry:
+		e.lsn = l.next + uint64(len(l.pending))
+		l.buf = appendRecord(l.buf, e.data)
+		l.pending = append(l.pending, e)
+	case e.kind == truncateEntry:
+		e.err = l.truncate(e.lsn)
+	}
+}
+
+func (l *logBatcher) Finish() { l.flush() }
+
+// flush writes and syncs the pending records.
+func (l *logBatcher) flush() {
+	if len(l.pending) == 0 {
+		return
+	}
+
+	err := l.write()
+	for _, e := range l.pending {
+		e.err = err
+	}
+
+	clear(l.pending)
+	l.pending = l.pending[:0]
+	l.buf = l.buf[:0]
+}
+
+// write writes the buffered records with a single write and sync,
+// starting a new segment when the active one is full.
+func (l *logBatcher) write() error {
+	if l.active.Size >= l.opts.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := l.active.Append(l.buf); err != nil {
+		// A rolled back write does not break the log.
+		l.err = l.active.Err
+		return err
+	}
+	l.next += uint64(len(l.pending))
+	return nil
+}
+
+// rotate closes the active segment and starts a new one.
+func (l *logBatcher) rotate() error {
+	err := l.active.File.Close()
+	l.active.File = nil
+	if err != nil {
+		l.err = err
+		return err
+	}
+	if err := (*Log)(l).create(l.next); err != nil {
+		l.err = err
+		return err
+	}
+	return nil
+}
+
+// truncate removes the segments that only contain records before lsn.
+func (l *logBatcher) truncate(lsn uint64) error {
+	removed := false
+	for len(l.segments) > 1 && l.segments[1] <= lsn {
+		if err := os.Remove(segmentPath(l.dir, l.segments[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		l.segments = l.segments[1:]
+		removed = true
+	}
+	if !removed {
+		return nil
+	}
+	return syncDir(l.dir)
+}
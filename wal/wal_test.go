@@ -0,0 +1,263 @@
+package wal_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner/wal"
+)
+
+func open(t *testing.T, dir string, opts wal.Options) *wal.Log {
+	t.Helper()
+	l, err := wal.Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func appendAll(t *testing.T, l *wal.Log, records ...string) []uint64 {
+	t.Helper()
+	var lsns []uint64
+	for _, record := range records {
+		lsn, err := l.Append([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lsns = append(lsns, lsn)
+	}
+	return lsns
+}
+
+func replay(t *testing.T, dir string, from uint64) (lsns []uint64, records []string) {
+	t.Helper()
+	r, err := wal.NewReader(dir, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for {
+		lsn, data, err := r.Next()
+		if err == io.EOF {
+			return lsns, records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lsns = append(lsns, lsn)
+		records = append(records, string(data))
+	}
+}
+
+func segments(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLogConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{SegmentSize: 256})
+
+	const procs, count = 8, 50
+	var mu sync.Mutex
+	written := map[uint64]string{}
+
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				record := fmt.Sprintf("%d-%d", p, i)
+				lsn, err := l.Append([]byte(record))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				written[lsn] = record
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append(nil); !errors.Is(err, wal.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+
+	if len(segments(t, dir)) < 2 {
+		t.Fatal("expected segments to rotate")
+	}
+
+	lsns, records := replay(t, dir, 0)
+	if len(lsns) != procs*count {
+		t.Fatalf("expected %v records, got %v", procs*count, len(lsns))
+	}
+	for i, lsn := range lsns {
+		if lsn != uint64(i+1) || written[lsn] != records[i] {
+			t.Fatalf("record %v: got %v %q, expected %q", i, lsn, records[i], written[lsn])
+		}
+	}
+}
+
+func TestLogReopen(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{})
+	appendAll(t, l, "a", "b")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l = open(t, dir, wal.Options{})
+	if lsns := appendAll(t, l, "c"); lsns[0] != 3 {
+		t.Fatalf("expected LSN 3, got %v", lsns[0])
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, records := replay(t, dir, 2); fmt.Sprint(records) != "[b c]" {
+		t.Fatalf("unexpected records %q", records)
+	}
+}
+
+func TestLogTornTail(t *testing.T) {
+	for _, damage := range []struct {
+		name  string
+		apply func(data []byte) []byte
+		kept  []string
+	}{
+		{"TruncatedData", func(data []byte) []byte { return data[:len(data)-2] }, []string{"first", "second"}},
+		{"TruncatedHeader", func(data []byte) []byte { return data[:len(data)-len("third")-4] }, []string{"first", "second"}},
+		{"Checksum", func(data []byte) []byte { data[len(data)-1] ^= 0xFF; return data }, []string{"first", "second"}},
+		{"Garbage", func(data []byte) []byte { return append(data, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0) }, []string{"first", "second", "third"}},
+	} {
+		t.Run(damage.name, func(t *testing.T) {
+			dir := t.TempDir()
+			l := open(t, dir, wal.Options{})
+			appendAll(t, l, "first", "second", "third")
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// simulate a crash during the last append
+			name := segments(t, dir)[0]
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(name, damage.apply(data), 0o666); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, records := replay(t, dir, 0); fmt.Sprint(records) != fmt.Sprint(damage.kept) {
+				t.Fatalf("unexpected records %q", records)
+			}
+
+			l = open(t, dir, wal.Options{})
+			lsns := appendAll(t, l, "fourth")
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if lsns[0] != uint64(len(damage.kept)+1) {
+				t.Fatalf("expected LSN %v, got %v", len(damage.kept)+1, lsns[0])
+			}
+
+			_, records := replay(t, dir, 0)
+			if fmt.Sprint(records) != fmt.Sprint(append(damage.kept, "fourth")) {
+				t.Fatalf("unexpected records %q", records)
+			}
+		})
+	}
+}
+
+func TestLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{SegmentSize: 1})
+	appendAll(t, l, "a", "b", "c", "d")
+	if n := len(segments(t, dir)); n != 4 {
+		t.Fatalf("expected 4 segments, got %v", n)
+	}
+
+	// checkpoint includes a and b
+	if err := l.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(segments(t, dir)); n != 2 {
+		t.Fatalf("expected 2 segments, got %v", n)
+	}
+
+	lsns, records := replay(t, dir, 0)
+	if fmt.Sprint(lsns, records) != "[3 4] [c d]" {
+		t.Fatalf("unexpected records %v %q", lsns, records)
+	}
+
+	// the active segment is never removed
+	if err := l.Truncate(100); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(segments(t, dir)); n != 1 {
+		t.Fatalf("expected 1 segment, got %v", n)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogSyncError(t *testing.T) {
+	failure := errors.New("sync failed")
+	l := open(t, t.TempDir(), wal.Options{
+		Sync: func(f *os.File) error { return failure },
+	})
+
+	// a failed sync leaves the log in an unknown state
+	for i := 0; i < 2; i++ {
+		if _, err := l.Append([]byte("x")); !errors.Is(err, failure) {
+			t.Fatalf("expected sync failure, got %v", err)
+		}
+	}
+	if err := l.Close(); !errors.Is(err, failure) {
+		t.Fatalf("expected sync failure, got %v", err)
+	}
+	if err := l.Close(); !errors.Is(err, wal.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestReaderCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	l := open(t, dir, wal.Options{SegmentSize: 1})
+	appendAll(t, l, "a", "b", "c")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// damage in an earlier segment is not a torn tail
+	name := segments(t, dir)[0]
+	if err := os.Truncate(name, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := wal.NewReader(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, _, err := r.Next(); !errors.Is(err, wal.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package combiner
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Watchdog reports batches that run longer than a threshold.
+type Watchdog struct {
+	// Threshold is the batch duration after which the batch is reported.
+	// The report is repeated every time the duration doubles.
+	Threshold time.Duration
+	// Report is called for each stalled batch report.
+	// When Report is nil, the stall is logged using Logger.
+	Report func(Stall)
+	// Logger is used when Report is nil.
+	// When Logger is nil, slog.Default() is used.
+	Logger *slog.Logger
+}
+
+// Stall describes a batch that has been running longer than the threshold.
+type Stall struct {
+	// Queue is the name of the queue.
+	Queue string
+	// Batch is the sequence number of the batch.
+	Batch uint64
+	// Duration is how long the batch has been running.
+	Duration time.Duration
+	// Level is 0 for the first report of a batch and increases
+	// with each escalation.
+	Level int
+	// Stack is the stack of the combiner goroutine.
+	Stack []byte
+}
+
+// StartWatchdog starts monitoring the queue for stalled batches.
+//
+// Only a single watchdog can be running for a queue.
+// The returned func stops the watchdog.
+func (q *Queue[T]) StartWatchdog(w Watchdog) (stop func()) {
+	if w.Threshold <= 0 {
+		panic("combiner watchdog threshold must be positive")
+	}
+
+	watch := &batchWatch{}
+	if !q.watch.CompareAndSwap(nil, watch) {
+		panic("combiner watchdog already running")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watch.monitor(ctx, q.Name, w)
+	}()
+
+	watch.stop = sync.OnceFunc(func() {
+		cancel()
+		wg.Wait()
+		q.watch.CompareAndSwap(watch, nil)
+	})
+	return watch.stop
+}
+
+// batchWatch tracks the currently running batch.
+type batchWatch struct {
+	// stop stops the watchdog, it is also called by Queue.Close.
+	stop func()
+
+	batch   atomic.Uint64
+	started atomic.Int64 // unix nanoseconds, 0 when idle
+	goid    atomic.Int64
+}
+
+// begin is called by the combiner before starting a batch.
+func (watch *batchWatch) begin() {
+	watch.goid.Store(goid())
+	watch.batch.Add(1)
+	watch.started.Store(time.Now().UnixNano())
+}
+
+// end is called by the combiner after finishing a batch.
+func (watch *batchWatch) end() {
+	watch.started.Store(0)
+}
+
+// monitor checks the running batch until ctx is cancelled.
+func (watch *batchWatch) monitor(ctx context.Context, name string, w Watchdog) {
+	interval := w.Threshold / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reported uint64
+	level := 0
+	next := w.Threshold
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			batch := watch.batch.Load()
+			started := watch.started.Load()
+			if started == 0 || batch != watch.batch.Load() {
+				continue
+			}
+
+			if batch != reported {
+				reported, level, next = batch, 0, w.Threshold
+			}
+
+			duration := now.Sub(time.Unix(0, started))
+			if duration < next {
+				continue
+			}
+
+			stall := Stall{
+				Queue:    name,
+				Batch:    batch,
+				Duration: duration,
+				Level:    level,
+				Stack:    goroutineStack(watch.goid.Load()),
+			}
+			level++
+			for next <= duration {
+				next *= 2
+			}
+
+			if w.Report != nil {
+				w.Report(stall)
+			} else {
+				logStall(w.Logger, stall)
+			}
+		}
+	}
+}
+
+// logStall logs the stall using the logger.
+func logStall(logger *slog.Logger, stall Stall) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	level := slog.LevelWarn
+	if stall.Level > 0 {
+		level = slog.LevelError
+	}
+	logger.Log(context.Background(), level, "combiner batch stalled",
+		slog.String("queue", stall.Queue),
+		slog.Uint64("batch", stall.Batch),
+		slog.Duration("duration", stall.Duration),
+		slog.Int("level", stall.Level),
+		slog.String("stack", string(stall.Stack)),
+	)
+}
@@ -0,0 +1,56 @@
+package combiner_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"loov.dev/combiner"
+)
+
+type blockingFinish struct {
+	release chan struct{}
+}
+
+func (b *blockingFinish) Start()     {}
+func (b *blockingFinish) Do(arg int) {}
+func (b *blockingFinish) Finish()    { <-b.release }
+
+func TestWatchdog(t *testing.T) {
+	batcher := &blockingFinish{release: make(chan struct{})}
+	q := combiner.New[int](batcher, 0)
+	q.Name = "blocked"
+
+	stalls := make(chan combiner.Stall, 16)
+	stop := q.StartWatchdog(combiner.Watchdog{
+		Threshold: 5 * time.Millisecond,
+		Report:    func(stall combiner.Stall) { stalls <- stall },
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		q.Do(1)
+		close(done)
+	}()
+
+	for level := 0; level < 2; level++ {
+		select {
+		case stall := <-stalls:
+			if stall.Queue != "blocked" || stall.Level != level {
+				t.Fatalf("unexpected stall %+v", stall)
+			}
+			if stall.Duration < 5*time.Millisecond<<level {
+				t.Fatalf("reported too early %v", stall.Duration)
+			}
+			if !bytes.Contains(stall.Stack, []byte("blockingFinish).Finish")) {
+				t.Fatalf("stack does not contain Finish:\n%s", stall.Stack)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("watchdog did not report")
+		}
+	}
+
+	close(batcher.release)
+	<-done
+}
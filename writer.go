@@ -0,0 +1,90 @@
+package combiner
+
+import "io"
+
+// WriterOptions configures a Writer.
+type WriterOptions struct {
+	// Limit is the maximum number of writes in a single batch.
+	// Zero means there is no limit.
+	Limit int
+	// Flush, when set, is called after each batch has been written,
+	// for example to sync a file.
+	Flush func() error
+}
+
+// Writer is an io.Writer that can be used concurrently.
+//
+// Concurrent writes are combined into a single write to the underlying
+// writer. The bytes of each write stay contiguous.
+type Writer struct {
+	w     io.Writer
+	flush func() error
+	queue Queue[*write]
+
+	// The following fields are only used by the combiner.
+	pending []*write
+	buf     []byte
+}
+
+// write is a single Write call.
+type write struct {
+	data []byte
+	n    int
+	err  error
+}
+
+// NewWriter creates a combining writer for w.
+func NewWriter(w io.Writer, opts WriterOptions) *Writer {
+	cw := &Writer{w: w, flush: opts.Flush}
+	cw.queue.Init((*writeBatcher)(cw), opts.Limit)
+	return cw
+}
+
+// Write writes p to the underlying writer and waits for completion.
+//
+// When writing or flushing the batch fails, every Write in the batch
+// returns the error, together with the number of its bytes that
+// were written.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	r := &write{data: p}
+	w.queue.Do(r)
+	return r.n, r.err
+}
+
+// Stats returns a snapshot of the queue statistics.
+func (w *Writer) Stats() Stats { return w.queue.Stats() }
+
+// Control returns the underlying queue.
+func (w *Writer) Control() Control { return &w.queue }
+
+// writeBatcher implements Batcher for Writer.
+type writeBatcher Writer
+
+func (w *writeBatcher) Start() {}
+
+func (w *writeBatcher) Do(r *write) {
+	w.buf = append(w.buf, r.data...)
+	w.pending = append(w.pending, r)
+}
+
+func (w *writeBatcher) Finish() {
+	written, err := w.w.Write(w.buf)
+	if err == nil && written < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	if err == nil && w.flush != nil {
+		err = w.flush()
+	}
+
+	// Each write gets the part of written that belongs to it.
+	offset := 0
+	for _, r := range w.pending {
+		r.n = min(max(written-offset, 0), len(r.data))
+		r.err = err
+		offset += len(r.data)
+	}
+
+	clear(w.pending)
+	w.pending = w.pending[:0]
+	w.buf = w.buf[:0]
+}
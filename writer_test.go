@@ -0,0 +1,105 @@
+package combiner_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"loov.dev/combiner"
+)
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	flushes := 0
+	w := combiner.NewWriter(&out, combiner.WriterOptions{
+		Flush: func() error { flushes++; return nil },
+	})
+	logger := log.New(w, "", 0)
+
+	const procs, count = 8, 100
+	var wg sync.WaitGroup
+	for p := 0; p < procs; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				logger.Printf("%d %s", p, strings.Repeat("x", i))
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != procs*count {
+		t.Fatalf("expected %v lines, got %v", procs*count, len(lines))
+	}
+	next := make([]int, procs)
+	for _, line := range lines {
+		proc, xs, _ := strings.Cut(line, " ")
+		p, err := strconv.Atoi(proc)
+		if err != nil || p < 0 || p >= procs {
+			t.Fatalf("interleaved line %q", line)
+		}
+		if xs != strings.Repeat("x", next[p]) {
+			t.Fatalf("unexpected line %q, expected %v x-s", line, next[p])
+		}
+		next[p]++
+	}
+
+	if stats := w.Stats(); uint64(flushes) != stats.Batches {
+		t.Fatalf("expected a flush per batch, got %v for %v batches", flushes, stats.Batches)
+	}
+}
+
+// limitedWriter accepts limit bytes and then fails.
+type limitedWriter struct {
+	limit int
+	err   error
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return w.limit, w.err
+	}
+	return len(p), nil
+}
+
+// errorWriter writes everything and fails.
+type errorWriter struct{ err error }
+
+func (w errorWriter) Write(p []byte) (int, error) { return len(p), w.err }
+
+func TestWriterErrors(t *testing.T) {
+	failure := errors.New("disk full")
+	var out limitedWriter
+	w := combiner.NewWriter(&out, combiner.WriterOptions{})
+
+	out.limit, out.err = 2, failure
+	if n, err := w.Write([]byte("abc")); n != 2 || err != failure {
+		t.Fatalf("got %v, %v", n, err)
+	}
+
+	out.limit, out.err = 1, nil
+	if n, err := w.Write([]byte("abc")); n != 1 || err != io.ErrShortWrite {
+		t.Fatalf("got %v, %v", n, err)
+	}
+
+	// a complete write can still fail
+	w = combiner.NewWriter(errorWriter{failure}, combiner.WriterOptions{})
+	if n, err := w.Write([]byte("abc")); n != 3 || err != failure {
+		t.Fatalf("got %v, %v", n, err)
+	}
+
+	flushFailure := errors.New("sync failed")
+	w = combiner.NewWriter(&limitedWriter{limit: 10}, combiner.WriterOptions{
+		Flush: func() error { return flushFailure },
+	})
+	if n, err := w.Write([]byte("abc")); n != 3 || err != flushFailure {
+		t.Fatalf("got %v, %v", n, err)
+	}
+}